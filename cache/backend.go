@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrEntryNotFound indica que la entrada no existe en el backend
+var ErrEntryNotFound = errors.New("cache entry not found")
+
+// Backend almacena los datos y metadatos de las entradas del caché.
+// CacheManager mantiene sobre él el índice, el tier en memoria y las políticas de expiración.
+type Backend interface {
+	// Load lee una entrada y sus metadatos; retorna ErrEntryNotFound si no existe
+	Load(key string) ([]byte, *EntryMeta, error)
+	// Store guarda una entrada; retain es el tiempo que debe conservarse (expiración más gracia)
+	Store(key string, data []byte, meta *EntryMeta, retain time.Duration) error
+	// Delete elimina una entrada; retorna ErrEntryNotFound si no existía
+	Delete(key string) error
+	// Scan recorre los metadatos de todas las entradas sin leer sus datos
+	Scan(fn func(key string, size int64, meta *EntryMeta)) error
+	// Shared indica si el backend es compartido por varias réplicas
+	Shared() bool
+	// Location describe dónde se almacenan las entradas (directorio o URL)
+	Location() string
+}
+
+// accessRecorder es implementado por los backends que pueden guardar los contadores de
+// acceso de una entrada sin reescribir sus datos
+type accessRecorder interface {
+	recordAccess(key string, hits int64, lastAccess time.Time) error
+}
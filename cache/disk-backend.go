@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DiskBackend guarda cada entrada como un archivo en un árbol de directorios local,
+// con sus metadatos en un archivo .meta al lado
+type DiskBackend struct {
+	dir        string
+	defaultTTL time.Duration // expiración de las entradas sin metadatos, desde su fecha de modificación
+}
+
+// NewDiskBackend crea el backend, creando el directorio si no existe
+func NewDiskBackend(dir string, defaultTTL time.Duration) *DiskBackend {
+	os.MkdirAll(dir, 0755)
+	return &DiskBackend{dir: dir, defaultTTL: defaultTTL}
+}
+
+// Load lee una entrada y sus metadatos
+func (db *DiskBackend) Load(key string) ([]byte, *EntryMeta, error) {
+	cachePath := db.entryPath(key)
+
+	fileInfo, err := os.Stat(cachePath)
+	if err != nil {
+		return nil, nil, ErrEntryNotFound
+	}
+	meta := db.loadEntryMeta(cachePath, fileInfo)
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, nil, ErrEntryNotFound
+	}
+	return data, meta, nil
+}
+
+// Store guarda una entrada. Los datos se escriben antes que los metadatos, ambos de forma
+// atómica: una interrupción deja a lo sumo datos sin metadatos, que se leen con el TTL por
+// defecto, y nunca metadatos de una entrada sin datos.
+func (db *DiskBackend) Store(key string, data []byte, meta *EntryMeta, retain time.Duration) error {
+	cachePath := db.entryPath(key)
+	if err := writeFileAtomic(cachePath, data); err != nil {
+		return err
+	}
+	return writeEntryMeta(cachePath, meta)
+}
+
+// Delete elimina una entrada y su archivo de metadatos. Los datos se eliminan primero
+// para que la entrada deje de ser visible antes de perder sus metadatos.
+func (db *DiskBackend) Delete(key string) error {
+	cachePath := db.entryPath(key)
+	err := os.Remove(cachePath)
+	os.Remove(metaPath(cachePath))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrEntryNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Scan recorre el directorio y reporta cada entrada. Elimina los temporales de escrituras
+// interrumpidas y los metadatos sin datos, y mueve las entradas del formato plano anterior
+// a su directorio. Sólo toca archivos con nombre de entrada ("<sha256>.<ext>" y sus .meta
+// y temporales) dentro del árbol de shards, de modo que otros datos guardados bajo el mismo
+// directorio (por ejemplo la cola de trabajos en ./cache/jobs) no se modifican.
+func (db *DiskBackend) Scan(fn func(key string, size int64, meta *EntryMeta)) error {
+	return filepath.WalkDir(db.dir, func(path string, file os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file.IsDir() {
+			if path != db.dir && !shardDirRe.MatchString(file.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := file.Name()
+		if isTempFile(name) {
+			os.Remove(path)
+			return nil
+		}
+		if isMetaFile(name) {
+			if isEntryFile(strings.TrimSuffix(name, metaSuffix)) {
+				db.removeOrphanMeta(path)
+			}
+			return nil
+		}
+		if !isEntryFile(name) {
+			return nil
+		}
+
+		// Migrar entradas al directorio que les corresponde
+		if expected := db.entryPath(name); path != expected {
+			if err := db.moveEntry(path, expected); err != nil {
+				fmt.Printf("Warning: failed to move cache entry %s: %v\n", name, err)
+				return nil
+			}
+			path = expected
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil
+		}
+		fn(name, info.Size(), db.loadEntryMeta(path, info))
+		return nil
+	})
+}
+
+// removeOrphanMeta elimina un archivo de metadatos cuya entrada ya no existe
+func (db *DiskBackend) removeOrphanMeta(path string) {
+	if _, err := os.Stat(strings.TrimSuffix(path, metaSuffix)); errors.Is(err, fs.ErrNotExist) {
+		os.Remove(path)
+	}
+}
+
+// recordAccess guarda los contadores de acceso en los metadatos de una entrada
+func (db *DiskBackend) recordAccess(key string, hits int64, lastAccess time.Time) error {
+	cachePath := db.entryPath(key)
+	meta, err := readEntryMeta(cachePath)
+	if err != nil {
+		return err
+	}
+	meta.Hits, meta.LastAccess = hits, lastAccess
+	return writeEntryMeta(cachePath, meta)
+}
+
+// Shared retorna false: el directorio pertenece a una sola réplica
+func (db *DiskBackend) Shared() bool {
+	return false
+}
+
+// Location retorna el directorio del caché
+func (db *DiskBackend) Location() string {
+	return db.dir
+}
+
+// entryPath retorna la ruta en disco de una entrada
+func (db *DiskBackend) entryPath(key string) string {
+	return shardPath(db.dir, key)
+}
+
+// moveEntry mueve una entrada y sus metadatos a otra ruta
+func (db *DiskBackend) moveEntry(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(metaPath(from), metaPath(to)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// loadEntryMeta obtiene los metadatos de una entrada.
+// Las entradas sin metadatos usan la fecha de modificación y el TTL por defecto.
+func (db *DiskBackend) loadEntryMeta(cachePath string, fileInfo os.FileInfo) *EntryMeta {
+	if meta, err := readEntryMeta(cachePath); err == nil {
+		return meta
+	}
+	return &EntryMeta{
+		CreatedAt: fileInfo.ModTime(),
+		ExpiresAt: fileInfo.ModTime().Add(db.defaultTTL),
+	}
+}
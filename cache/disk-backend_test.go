@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestFile crea un archivo y sus directorios
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestDiskBackendScan(t *testing.T) {
+	dir := t.TempDir()
+	backend := NewDiskBackend(dir, time.Hour)
+
+	key := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.jpg"
+	if err := backend.Store(key, []byte("data"), &EntryMeta{ExpiresAt: time.Now().Add(time.Hour)}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	orphan := "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff.png"
+	orphanMeta := metaPath(shardPath(dir, orphan))
+	writeTestFile(t, orphanMeta)
+
+	interrupted := shardPath(dir, key) + ".meta.123456.tmp"
+	writeTestFile(t, interrupted)
+
+	// Archivos de otros componentes bajo el mismo directorio
+	foreign := []string{
+		filepath.Join(dir, "jobs", "job-1.json"),
+		filepath.Join(dir, "jobs", "job-1.json.tmp"),
+		filepath.Join(dir, "notes.txt"),
+		filepath.Join(dir, "ab", "cd", "readme.md.meta"),
+	}
+	for _, path := range foreign {
+		writeTestFile(t, path)
+	}
+
+	var keys []string
+	if err := backend.Scan(func(key string, size int64, meta *EntryMeta) {
+		keys = append(keys, key)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || keys[0] != key {
+		t.Errorf("scanned keys = %v, want [%s]", keys, key)
+	}
+	if exists(orphanMeta) {
+		t.Error("orphan meta was not removed")
+	}
+	if exists(interrupted) {
+		t.Error("interrupted write was not removed")
+	}
+	for _, path := range foreign {
+		if !exists(path) {
+			t.Errorf("%s was removed", path)
+		}
+	}
+}
+
+// TestDiskBackendScanMigratesFlatEntries verifica que las entradas del formato plano anterior se muevan a su shard
+func TestDiskBackendScanMigratesFlatEntries(t *testing.T) {
+	dir := t.TempDir()
+	backend := NewDiskBackend(dir, time.Hour)
+
+	legacy := "0123456789abcdef0123456789abcdef.jpg"
+	writeTestFile(t, filepath.Join(dir, legacy))
+
+	if err := backend.Scan(func(string, int64, *EntryMeta) {}); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(shardPath(dir, legacy)) {
+		t.Error("legacy entry was not moved to its shard")
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// metaSuffix es la extensión del archivo de metadatos que acompaña a cada entrada
+const metaSuffix = ".meta"
+
+// EntryMeta contiene los metadatos almacenados junto a cada entrada del caché
+type EntryMeta struct {
+	CreatedAt          time.Time `json:"created_at"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	ContentType        string    `json:"content_type,omitempty"`
+	Width              int       `json:"width,omitempty"`
+	Height             int       `json:"height,omitempty"`
+	SourceURL          string    `json:"source_url,omitempty"`
+	ServedBy           string    `json:"served_by,omitempty"` // URL que sirvió el original (distinta de SourceURL si respondió un mirror)
+	ETag               string    `json:"etag,omitempty"`
+	OriginETag         string    `json:"origin_etag,omitempty"`          // ETag del original, para revalidar con If-None-Match
+	OriginLastModified string    `json:"origin_last_modified,omitempty"` // Last-Modified del original, para If-Modified-Since
+	Size               int64     `json:"size,omitempty"`                 // tamaño de la variante en bytes
+	OriginalSize       int64     `json:"original_size,omitempty"`        // tamaño de la imagen original en bytes
+	Tags               []string  `json:"tags,omitempty"`                 // etiquetas para invalidar en grupo
+	Hits               int64     `json:"hits,omitempty"`                 // accesos registrados por el índice
+	LastAccess         time.Time `json:"last_access,omitzero"`           // último acceso registrado por el índice
+	NoStore            bool      `json:"no_store,omitempty"`             // el origen prohibió almacenarla (no-store o private)
+}
+
+// Fill completa los campos derivables del contenido que no se hayan indicado
+func (m *EntryMeta) Fill(data []byte) {
+	m.Size = int64(len(data))
+	if m.ContentType == "" {
+		m.ContentType = http.DetectContentType(data)
+	}
+	if m.ETag == "" {
+		hash := sha256.Sum256(data)
+		m.ETag = fmt.Sprintf(`"%x"`, hash[:16])
+	}
+}
+
+// IsExpired indica si la entrada ha superado su fecha de expiración
+func (m *EntryMeta) IsExpired(now time.Time) bool {
+	return !now.Before(m.ExpiresAt)
+}
+
+// metaPath retorna la ruta del archivo de metadatos de una entrada
+func metaPath(cachePath string) string {
+	return cachePath + metaSuffix
+}
+
+// isMetaFile indica si un nombre de archivo corresponde a metadatos
+func isMetaFile(name string) bool {
+	return strings.HasSuffix(name, metaSuffix)
+}
+
+// writeEntryMeta guarda los metadatos de una entrada
+func writeEntryMeta(cachePath string, meta *EntryMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath(cachePath), data)
+}
+
+// readEntryMeta lee los metadatos de una entrada
+func readEntryMeta(cachePath string) (*EntryMeta, error) {
+	data, err := os.ReadFile(metaPath(cachePath))
+	if err != nil {
+		return nil, err
+	}
+	var meta EntryMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
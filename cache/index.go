@@ -0,0 +1,421 @@
+package cache
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EvictionPolicy determina qué entradas se desalojan primero cuando el caché se llena
+type EvictionPolicy string
+
+const (
+	PolicyLRU  EvictionPolicy = "lru"  // menos usada recientemente
+	PolicyLFU  EvictionPolicy = "lfu"  // menos aciertos; empates por último acceso
+	PolicyGDSF EvictionPolicy = "gdsf" // Greedy-Dual-Size-Frequency: favorece entradas pequeñas y populares
+)
+
+// ParseEvictionPolicy convierte el nombre de una política; vacío equivale a LRU
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch policy := EvictionPolicy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case "":
+		return PolicyLRU, nil
+	case PolicyLRU, PolicyLFU, PolicyGDSF:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown eviction policy: %s", name)
+	}
+}
+
+// indexEntry contiene los datos de una entrada necesarios para admisión, desalojo y estadísticas
+type indexEntry struct {
+	key          string
+	size         int64
+	accessedAt   time.Time
+	hits         int64
+	priority     float64 // prioridad GDSF; las menores se desalojan primero
+	expiresAt    time.Time
+	originalSize int64
+	contentType  string
+	sourceURL    string
+	tags         []string
+	position     int  // posición en el heap de desalojo
+	expiryPos    int  // posición en el heap de expiración (pending o expired)
+	expired      bool // la entrada está en el heap de expiradas
+	dirty        bool // tiene accesos que aún no se guardaron en sus metadatos
+}
+
+// accessRecord son los contadores de acceso de una entrada pendientes de guardar
+type accessRecord struct {
+	key        string
+	hits       int64
+	accessedAt time.Time
+}
+
+// cacheIndex mantiene en memoria todas las entradas del caché en disco.
+// Las entradas se ordenan en un heap según la política de desalojo, de modo que agregar,
+// acceder y desalojar son O(log n) y el tamaño total se conoce sin recorrer el disco.
+// Otros dos heaps ordenados por expiración separan las entradas vigentes de las expiradas,
+// de modo que las estadísticas y la limpieza no recorren todo el índice.
+type cacheIndex struct {
+	mu            sync.Mutex
+	entries       map[string]*indexEntry
+	queue         evictionQueue
+	pending       expiryQueue // entradas aún no expiradas
+	expired       expiryQueue // entradas expiradas, hasta que se eliminen
+	inflation     float64     // valor L de GDSF: prioridad de la última entrada desalojada
+	bytes         int64
+	originalBytes int64
+	hits          int64 // aciertos acumulados, sin contar el alta de cada entrada
+	contentTypes  map[string]int
+	tagged        map[string]map[string]bool // claves de las entradas por etiqueta
+}
+
+// newCacheIndex crea un índice vacío
+func newCacheIndex() *cacheIndex {
+	return &cacheIndex{
+		entries:      make(map[string]*indexEntry),
+		queue:        evictionQueue{policy: PolicyLRU},
+		contentTypes: make(map[string]int),
+		tagged:       make(map[string]map[string]bool),
+	}
+}
+
+// setPolicy cambia la política de desalojo y reordena el heap
+func (ci *cacheIndex) setPolicy(policy EvictionPolicy) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	ci.queue.policy = policy
+	heap.Init(&ci.queue)
+}
+
+// updatePriority recalcula la prioridad GDSF de una entrada: L + aciertos / tamaño en KB
+func (ci *cacheIndex) updatePriority(entry *indexEntry) {
+	sizeKB := float64(entry.size)/1024 + 1
+	entry.priority = ci.inflation + float64(entry.hits)/sizeKB
+}
+
+// add agrega o reemplaza una entrada. Al reemplazarla se conservan sus aciertos y último
+// acceso; una entrada nueva parte de los contadores guardados en sus metadatos, si existen.
+func (ci *cacheIndex) add(key string, size int64, accessedAt time.Time, meta *EntryMeta) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	hits := max(meta.Hits, 1)
+	if meta.LastAccess.After(accessedAt) {
+		accessedAt = meta.LastAccess
+	}
+	if existing, ok := ci.entries[key]; ok {
+		hits = existing.hits
+		if existing.accessedAt.After(accessedAt) {
+			accessedAt = existing.accessedAt
+		}
+		ci.removeEntry(existing)
+	}
+
+	entry := &indexEntry{
+		key:          key,
+		size:         size,
+		accessedAt:   accessedAt,
+		hits:         hits,
+		expiresAt:    meta.ExpiresAt,
+		originalSize: meta.OriginalSize,
+		contentType:  meta.ContentType,
+		sourceURL:    meta.SourceURL,
+		tags:         meta.Tags,
+	}
+	if entry.contentType == "" {
+		entry.contentType = "unknown"
+	}
+
+	ci.updatePriority(entry)
+
+	ci.entries[key] = entry
+	heap.Push(&ci.queue, entry)
+	heap.Push(&ci.pending, entry)
+	ci.hits += entry.hits - 1
+	ci.bytes += entry.size
+	ci.originalBytes += entry.originalSize
+	ci.contentTypes[entry.contentType]++
+	for _, tag := range entry.tags {
+		if ci.tagged[tag] == nil {
+			ci.tagged[tag] = make(map[string]bool)
+		}
+		ci.tagged[tag][key] = true
+	}
+}
+
+// touch registra un acierto en una entrada; retorna false si no está en el índice
+func (ci *cacheIndex) touch(key string, now time.Time) bool {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	entry, ok := ci.entries[key]
+	if !ok {
+		return false
+	}
+	entry.accessedAt = now
+	entry.hits++
+	entry.dirty = true
+	ci.hits++
+	ci.updatePriority(entry)
+	heap.Fix(&ci.queue, entry.position)
+	return true
+}
+
+// access retorna los contadores de acceso de una entrada
+func (ci *cacheIndex) access(key string) (hits int64, accessedAt time.Time, ok bool) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	entry, ok := ci.entries[key]
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	return entry.hits, entry.accessedAt, true
+}
+
+// takeDirty retorna los contadores de las entradas con accesos sin guardar y las marca como guardadas
+func (ci *cacheIndex) takeDirty() []accessRecord {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	var records []accessRecord
+	for key, entry := range ci.entries {
+		if entry.dirty {
+			entry.dirty = false
+			records = append(records, accessRecord{key: key, hits: entry.hits, accessedAt: entry.accessedAt})
+		}
+	}
+	return records
+}
+
+// has indica si una entrada está en el índice
+func (ci *cacheIndex) has(key string) bool {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	_, ok := ci.entries[key]
+	return ok
+}
+
+// remove elimina una entrada del índice si existe
+func (ci *cacheIndex) remove(key string) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	if entry, ok := ci.entries[key]; ok {
+		ci.removeEntry(entry)
+	}
+}
+
+// removeEntry elimina una entrada; requiere el lock
+func (ci *cacheIndex) removeEntry(entry *indexEntry) {
+	heap.Remove(&ci.queue, entry.position)
+	if entry.expired {
+		heap.Remove(&ci.expired, entry.expiryPos)
+	} else {
+		heap.Remove(&ci.pending, entry.expiryPos)
+	}
+	delete(ci.entries, entry.key)
+	ci.hits -= entry.hits - 1
+	ci.bytes -= entry.size
+	ci.originalBytes -= entry.originalSize
+	if ci.contentTypes[entry.contentType]--; ci.contentTypes[entry.contentType] <= 0 {
+		delete(ci.contentTypes, entry.contentType)
+	}
+	for _, tag := range entry.tags {
+		delete(ci.tagged[tag], entry.key)
+		if len(ci.tagged[tag]) == 0 {
+			delete(ci.tagged, tag)
+		}
+	}
+}
+
+// evict saca del índice las entradas de menor prioridad hasta que quepan needed bytes
+// dentro de maxBytes, y retorna sus claves para eliminarlas del disco
+func (ci *cacheIndex) evict(needed, maxBytes int64) []string {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	var evicted []string
+	for ci.bytes+needed > maxBytes && ci.queue.Len() > 0 {
+		entry := ci.queue.entries[0]
+		if entry.priority > ci.inflation {
+			ci.inflation = entry.priority
+		}
+		ci.removeEntry(entry)
+		evicted = append(evicted, entry.key)
+	}
+	return evicted
+}
+
+// advanceExpiry mueve al heap de expiradas las entradas que expiraron hasta now; requiere el lock
+func (ci *cacheIndex) advanceExpiry(now time.Time) {
+	for ci.pending.Len() > 0 && !now.Before(ci.pending.entries[0].expiresAt) {
+		entry := heap.Pop(&ci.pending).(*indexEntry)
+		entry.expired = true
+		heap.Push(&ci.expired, entry)
+	}
+}
+
+// expiredBefore retorna las claves de las entradas que expiraron antes del instante indicado.
+// Sólo visita las entradas expiradas que cumplen la condición: en un heap, las que expiraron
+// antes del corte forman un subárbol desde la raíz.
+func (ci *cacheIndex) expiredBefore(cutoff time.Time) []string {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	ci.advanceExpiry(cutoff)
+
+	var keys []string
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= ci.expired.Len() || !ci.expired.entries[i].expiresAt.Before(cutoff) {
+			continue
+		}
+		keys = append(keys, ci.expired.entries[i].key)
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+	return keys
+}
+
+// keysWhere retorna las claves de las entradas cuya URL de origen cumple la condición
+func (ci *cacheIndex) keysWhere(match func(sourceURL string) bool) []string {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	var keys []string
+	for key, entry := range ci.entries {
+		if match(entry.sourceURL) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// keysWithTags retorna las claves de las entradas que tienen alguna de las etiquetas
+func (ci *cacheIndex) keysWithTags(tags []string) []string {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var keys []string
+	for _, tag := range tags {
+		for key := range ci.tagged[tag] {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// size retorna el tamaño total de las entradas
+func (ci *cacheIndex) size() int64 {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	return ci.bytes
+}
+
+// stats retorna las estadísticas agregadas del índice
+func (ci *cacheIndex) stats(now time.Time) *CacheStats {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	ci.advanceExpiry(now)
+
+	stats := &CacheStats{
+		Policy:        string(ci.queue.policy),
+		Hits:          ci.hits,
+		Entries:       len(ci.entries),
+		Bytes:         ci.bytes,
+		OriginalBytes: ci.originalBytes,
+		Expired:       ci.expired.Len(),
+		ContentTypes:  make(map[string]int, len(ci.contentTypes)),
+	}
+	for contentType, count := range ci.contentTypes {
+		stats.ContentTypes[contentType] = count
+	}
+	return stats
+}
+
+// evictionQueue es un heap de entradas ordenado según la política de desalojo
+// (la primera entrada es la siguiente en desalojarse)
+type evictionQueue struct {
+	entries []*indexEntry
+	policy  EvictionPolicy
+}
+
+func (eq evictionQueue) Len() int { return len(eq.entries) }
+
+func (eq evictionQueue) Less(i, j int) bool {
+	a, b := eq.entries[i], eq.entries[j]
+	switch eq.policy {
+	case PolicyLFU:
+		if a.hits != b.hits {
+			return a.hits < b.hits
+		}
+	case PolicyGDSF:
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+	}
+	return a.accessedAt.Before(b.accessedAt)
+}
+
+func (eq evictionQueue) Swap(i, j int) {
+	eq.entries[i], eq.entries[j] = eq.entries[j], eq.entries[i]
+	eq.entries[i].position = i
+	eq.entries[j].position = j
+}
+
+func (eq *evictionQueue) Push(x interface{}) {
+	entry := x.(*indexEntry)
+	entry.position = len(eq.entries)
+	eq.entries = append(eq.entries, entry)
+}
+
+func (eq *evictionQueue) Pop() interface{} {
+	old := eq.entries
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	eq.entries = old[:len(old)-1]
+	return entry
+}
+
+// expiryQueue es un heap de entradas ordenado por fecha de expiración
+type expiryQueue struct {
+	entries []*indexEntry
+}
+
+func (eq expiryQueue) Len() int { return len(eq.entries) }
+
+func (eq expiryQueue) Less(i, j int) bool {
+	return eq.entries[i].expiresAt.Before(eq.entries[j].expiresAt)
+}
+
+func (eq expiryQueue) Swap(i, j int) {
+	eq.entries[i], eq.entries[j] = eq.entries[j], eq.entries[i]
+	eq.entries[i].expiryPos = i
+	eq.entries[j].expiryPos = j
+}
+
+func (eq *expiryQueue) Push(x interface{}) {
+	entry := x.(*indexEntry)
+	entry.expiryPos = len(eq.entries)
+	eq.entries = append(eq.entries, entry)
+}
+
+func (eq *expiryQueue) Pop() interface{} {
+	old := eq.entries
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	eq.entries = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestIndexExpiry(t *testing.T) {
+	index := newCacheIndex()
+	now := time.Now()
+
+	// Entradas que expiran cada minuto a partir de ahora, desordenadas
+	for _, minutes := range []int{5, -3, 1, -1, 4, -2, 0, 2, 3} {
+		key := fmt.Sprintf("k%d", minutes)
+		index.add(key, 10, now, &EntryMeta{ExpiresAt: now.Add(time.Duration(minutes) * time.Minute)})
+	}
+
+	if got := index.stats(now).Expired; got != 4 {
+		t.Errorf("expired = %d, want 4", got)
+	}
+
+	keys := index.expiredBefore(now.Add(-90 * time.Second))
+	sort.Strings(keys)
+	if fmt.Sprint(keys) != "[k-2 k-3]" {
+		t.Errorf("expiredBefore = %v, want [k-2 k-3]", keys)
+	}
+
+	// Las entradas eliminadas dejan de contarse y las nuevas expiraciones se acumulan
+	index.remove("k-3")
+	index.remove("k2")
+	if got := index.stats(now.Add(3 * time.Minute)).Expired; got != 5 {
+		t.Errorf("expired = %d after removals, want 5", got)
+	}
+	if got := len(index.expiredBefore(now.Add(time.Hour))); got != 7 {
+		t.Errorf("expiredBefore returned %d keys, want 7", got)
+	}
+}
+
+func TestIndexHits(t *testing.T) {
+	index := newCacheIndex()
+	now := time.Now()
+	meta := &EntryMeta{ExpiresAt: now.Add(time.Hour)}
+
+	index.add("a", 10, now, meta)
+	index.add("b", 10, now, meta)
+	index.touch("a", now)
+	index.touch("a", now)
+	index.touch("b", now)
+	if got := index.stats(now).Hits; got != 3 {
+		t.Errorf("hits = %d, want 3", got)
+	}
+
+	index.remove("a")
+	if got := index.stats(now).Hits; got != 1 {
+		t.Errorf("hits = %d after removal, want 1", got)
+	}
+}
+
+func TestIndexReplaceKeepsCounters(t *testing.T) {
+	index := newCacheIndex()
+	now := time.Now()
+	meta := &EntryMeta{ExpiresAt: now.Add(time.Hour)}
+
+	index.add("a", 10, now, meta)
+	index.touch("a", now.Add(time.Minute))
+	index.touch("a", now.Add(2*time.Minute))
+	index.add("a", 20, now, meta)
+
+	hits, accessedAt, _ := index.access("a")
+	if hits != 3 || !accessedAt.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("access = %d, %v; want 3 hits at the last touch", hits, accessedAt)
+	}
+	if got := index.stats(now).Hits; got != 2 {
+		t.Errorf("hits = %d, want 2", got)
+	}
+}
+
+// TestAccessCountersSurviveRestart verifica que los aciertos se restauren al reconstruir el índice
+func TestAccessCountersSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	cm := NewCacheManager(dir, time.Hour, 10)
+	key := cm.GenerateCacheKey("v2?src=a", "jpeg")
+	if err := cm.SaveToCache(key, []byte("data"), time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	cm.GetCachedImage(key)
+	cm.GetCachedImage(key)
+	cm.CleanupOldFiles()
+
+	restarted := NewCacheManager(dir, time.Hour, 10)
+	stats, _ := restarted.GetStats()
+	if stats.Hits != 2 {
+		t.Errorf("hits after restart = %d, want 2", stats.Hits)
+	}
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// tmpSuffix es la extensión de los archivos temporales usados en escrituras atómicas
+const tmpSuffix = ".tmp"
+
+// entryKeyRe reconoce las claves de las entradas: SHA-256 de los parámetros canónicos,
+// o MD5 en las entradas del esquema anterior, seguido de la extensión del formato
+var entryKeyRe = regexp.MustCompile(`^[0-9a-f]{32}(?:[0-9a-f]{32})?\.[a-z]+$`)
+
+// tempFileRe reconoce los temporales de writeFileAtomic de una entrada o de sus metadatos
+var tempFileRe = regexp.MustCompile(`^[0-9a-f]{32}(?:[0-9a-f]{32})?\.[a-z]+(?:\.meta)?\.[0-9]+\.tmp$`)
+
+// shardDirRe reconoce los directorios de los dos niveles del árbol de entradas
+var shardDirRe = regexp.MustCompile(`^[0-9a-f]{2}$`)
+
+// shardPath retorna la ruta de una entrada dentro de un árbol de dos niveles
+// derivado de su clave ("ab/cd/abcd...jpg"), para no acumular todo en un directorio
+func shardPath(dir, key string) string {
+	if len(key) < 4 {
+		return filepath.Join(dir, key)
+	}
+	return filepath.Join(dir, key[0:2], key[2:4], key)
+}
+
+// isEntryFile indica si un nombre de archivo corresponde a los datos de una entrada
+func isEntryFile(name string) bool {
+	return entryKeyRe.MatchString(name)
+}
+
+// isTempFile indica si un nombre de archivo corresponde a una escritura incompleta
+// de una entrada o de sus metadatos ("<clave>[.meta].<aleatorio>.tmp")
+func isTempFile(name string) bool {
+	return tempFileRe.MatchString(name)
+}
+
+// writeFileAtomic escribe un archivo de forma atómica (archivo temporal + rename),
+// de modo que los lectores nunca observen un archivo a medio escribir
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*"+tmpSuffix)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// memoryItemShare limita el tamaño de una entrada a una fracción del presupuesto,
+// para que una imagen grande no desplace a todas las demás
+const memoryItemShare = 8
+
+// MemoryTier es un caché LRU en memoria, limitado por tamaño, para las variantes más solicitadas.
+// Se consulta antes que el disco; las entradas leídas del disco se promueven a memoria.
+type MemoryTier struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	order    *list.List // más recientes al frente
+	items    map[string]*list.Element
+	hits     int64
+	misses   int64
+}
+
+// memoryItem es una entrada del tier en memoria
+type memoryItem struct {
+	key  string
+	data []byte
+	meta *EntryMeta
+}
+
+// MemoryStats resume el estado del tier en memoria
+type MemoryStats struct {
+	Entries  int   `json:"entries"`
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"max_bytes"`
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+}
+
+// NewMemoryTier crea un tier en memoria con el presupuesto indicado en MB; 0 lo deshabilita
+func NewMemoryTier(maxSizeMB int) *MemoryTier {
+	if maxSizeMB <= 0 {
+		return nil
+	}
+	return &MemoryTier{
+		maxBytes: int64(maxSizeMB) * 1024 * 1024,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get retorna una entrada y la marca como la más reciente
+func (mt *MemoryTier) get(key string) ([]byte, *EntryMeta, bool) {
+	if mt == nil {
+		return nil, nil, false
+	}
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	element, ok := mt.items[key]
+	if !ok {
+		mt.misses++
+		return nil, nil, false
+	}
+	mt.hits++
+	mt.order.MoveToFront(element)
+	item := element.Value.(*memoryItem)
+	return item.data, item.meta, true
+}
+
+// put agrega o reemplaza una entrada, desalojando las menos recientes hasta respetar el presupuesto
+func (mt *MemoryTier) put(key string, data []byte, meta *EntryMeta) {
+	if mt == nil {
+		return
+	}
+	size := int64(len(data))
+	if size > mt.maxBytes/memoryItemShare {
+		mt.remove(key)
+		return
+	}
+
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	if element, ok := mt.items[key]; ok {
+		mt.removeElement(element)
+	}
+	mt.items[key] = mt.order.PushFront(&memoryItem{key: key, data: data, meta: meta})
+	mt.bytes += size
+
+	for mt.bytes > mt.maxBytes {
+		mt.removeElement(mt.order.Back())
+	}
+}
+
+// remove elimina una entrada si existe
+func (mt *MemoryTier) remove(key string) {
+	if mt == nil {
+		return
+	}
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	if element, ok := mt.items[key]; ok {
+		mt.removeElement(element)
+	}
+}
+
+// removeElement elimina un elemento; requiere el lock
+func (mt *MemoryTier) removeElement(element *list.Element) {
+	item := mt.order.Remove(element).(*memoryItem)
+	delete(mt.items, item.key)
+	mt.bytes -= int64(len(item.data))
+}
+
+// stats retorna el estado actual del tier
+func (mt *MemoryTier) stats() *MemoryStats {
+	if mt == nil {
+		return nil
+	}
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	return &MemoryStats{
+		Entries:  len(mt.items),
+		Bytes:    mt.bytes,
+		MaxBytes: mt.maxBytes,
+		Hits:     mt.hits,
+		Misses:   mt.misses,
+	}
+}
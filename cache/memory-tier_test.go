@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"testing"
+)
+
+// newTestMemoryTier crea un tier con un presupuesto en bytes, menor que el mínimo de 1 MB de NewMemoryTier
+func newTestMemoryTier(maxBytes int64) *MemoryTier {
+	return &MemoryTier{maxBytes: maxBytes, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// TestMemoryTierEvictsLeastRecentlyUsed verifica el desalojo LRU al superar el presupuesto
+func TestMemoryTierEvictsLeastRecentlyUsed(t *testing.T) {
+	mt := newTestMemoryTier(800) // entradas de hasta 100 bytes
+	value := bytes.Repeat([]byte("x"), 100)
+
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		mt.put(key, value, &EntryMeta{})
+	}
+	// "a" pasa a ser la más reciente, así que la siguiente en desalojarse es "b"
+	if _, _, ok := mt.get("a"); !ok {
+		t.Fatal("a was evicted before exceeding the budget")
+	}
+	mt.put("i", value, &EntryMeta{})
+
+	if _, _, ok := mt.get("b"); ok {
+		t.Error("b should have been evicted as the least recently used entry")
+	}
+	for _, key := range []string{"a", "c", "i"} {
+		if _, _, ok := mt.get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+
+	stats := mt.stats()
+	if stats.Entries != 8 || stats.Bytes != 800 || stats.Hits != 4 || stats.Misses != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+// TestMemoryTierItemLimit verifica que una entrada mayor que 1/8 del presupuesto no se guarde
+func TestMemoryTierItemLimit(t *testing.T) {
+	mt := newTestMemoryTier(800)
+	mt.put("small", bytes.Repeat([]byte("x"), 100), &EntryMeta{})
+	mt.put("large", bytes.Repeat([]byte("x"), 101), &EntryMeta{})
+	if _, _, ok := mt.get("large"); ok {
+		t.Error("an entry over the per-item limit was stored")
+	}
+
+	// Reemplazar una entrada por una versión demasiado grande elimina la anterior
+	mt.put("small", bytes.Repeat([]byte("x"), 200), &EntryMeta{})
+	if _, _, ok := mt.get("small"); ok {
+		t.Error("the previous version of a replaced entry was kept")
+	}
+	if stats := mt.stats(); stats.Bytes != 0 {
+		t.Errorf("bytes = %d, want 0", stats.Bytes)
+	}
+}
+
+// TestMemoryTierDisabled verifica que un tier deshabilitado (nil) pueda usarse sin efectos
+func TestMemoryTierDisabled(t *testing.T) {
+	mt := NewMemoryTier(0)
+	if mt != nil {
+		t.Fatal("NewMemoryTier(0) should disable the tier")
+	}
+	mt.put("a", []byte("x"), &EntryMeta{})
+	if _, _, ok := mt.get("a"); ok {
+		t.Error("disabled tier returned an entry")
+	}
+	mt.remove("a")
+	if mt.stats() != nil {
+		t.Error("disabled tier returned stats")
+	}
+}
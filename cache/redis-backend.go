@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisScanCount es el número de claves que se piden a Redis en cada iteración de SCAN
+	redisScanCount = 500
+	// redisTimeout limita la conexión y cada comando enviado a Redis
+	redisTimeout = 5 * time.Second
+)
+
+// RedisBackend guarda las entradas en Redis para que varias réplicas compartan las variantes.
+// Cada entrada ocupa dos claves, "<prefijo>data:<clave>" y "<prefijo>meta:<clave>", que se
+// escriben juntas en una transacción y expiran en Redis al terminar su ventana de gracia.
+type RedisBackend struct {
+	client   *redis.Client
+	prefix   string
+	location string
+}
+
+// NewRedisBackend conecta con Redis a partir de una URL redis:// o rediss://.
+// poolSize es el número de conexiones inactivas que se mantienen abiertas.
+func NewRedisBackend(rawURL, prefix string, poolSize int) (*RedisBackend, error) {
+	options, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %v", err)
+	}
+	options.DialTimeout = redisTimeout
+	options.ReadTimeout = redisTimeout
+	options.WriteTimeout = redisTimeout
+	if poolSize > 0 {
+		options.MaxIdleConns = poolSize
+	}
+
+	client := redis.NewClient(options)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis: %v", err)
+	}
+
+	scheme := "redis"
+	if options.TLSConfig != nil {
+		scheme = "rediss"
+	}
+	return &RedisBackend{
+		client:   client,
+		prefix:   prefix,
+		location: fmt.Sprintf("%s://%s/%d", scheme, options.Addr, options.DB),
+	}, nil
+}
+
+// Load lee una entrada y sus metadatos con un único MGET
+func (rb *RedisBackend) Load(key string) ([]byte, *EntryMeta, error) {
+	values, err := rb.client.MGet(context.Background(), rb.metaKey(key), rb.dataKey(key)).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// MGET responde nil para las claves inexistentes
+	rawMeta, metaFound := values[0].(string)
+	data, dataFound := values[1].(string)
+	if !metaFound || !dataFound {
+		return nil, nil, ErrEntryNotFound
+	}
+
+	var meta EntryMeta
+	if err := json.Unmarshal([]byte(rawMeta), &meta); err != nil {
+		return nil, nil, fmt.Errorf("invalid cache metadata: %v", err)
+	}
+	return []byte(data), &meta, nil
+}
+
+// Store guarda los datos y los metadatos en una transacción, con expiración en Redis
+func (rb *RedisBackend) Store(key string, data []byte, meta *EntryMeta, retain time.Duration) error {
+	rawMeta, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	retain = max(retain, time.Millisecond)
+
+	_, err = rb.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Set(context.Background(), rb.metaKey(key), rawMeta, retain)
+		pipe.Set(context.Background(), rb.dataKey(key), data, retain)
+		return nil
+	})
+	return err
+}
+
+// Delete elimina los datos y los metadatos de una entrada
+func (rb *RedisBackend) Delete(key string) error {
+	deleted, err := rb.client.Del(context.Background(), rb.metaKey(key), rb.dataKey(key)).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+// Scan recorre las claves de metadatos con SCAN y lee cada lote con MGET
+func (rb *RedisBackend) Scan(fn func(key string, size int64, meta *EntryMeta)) error {
+	ctx := context.Background()
+	metaPrefix := rb.prefix + "meta:"
+	var cursor uint64
+	for {
+		keys, next, err := rb.client.Scan(ctx, cursor, metaPrefix+"*", redisScanCount).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			values, err := rb.client.MGet(ctx, keys...).Result()
+			if err != nil {
+				return err
+			}
+			for i, value := range values {
+				// La entrada pudo expirar o eliminarse entre SCAN y MGET
+				rawMeta, ok := value.(string)
+				if !ok {
+					continue
+				}
+				var meta EntryMeta
+				if err := json.Unmarshal([]byte(rawMeta), &meta); err != nil {
+					continue
+				}
+				fn(keys[i][len(metaPrefix):], meta.Size, &meta)
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// Shared retorna true: todas las réplicas usan las mismas entradas
+func (rb *RedisBackend) Shared() bool {
+	return true
+}
+
+// Location retorna la dirección del servidor Redis, sin credenciales
+func (rb *RedisBackend) Location() string {
+	return rb.location
+}
+
+// dataKey retorna la clave de Redis con los datos de una entrada
+func (rb *RedisBackend) dataKey(key string) string {
+	return rb.prefix + "data:" + key
+}
+
+// metaKey retorna la clave de Redis con los metadatos de una entrada
+func (rb *RedisBackend) metaKey(key string) string {
+	return rb.prefix + "meta:" + key
+}
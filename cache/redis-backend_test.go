@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedisBackend conecta un backend al servidor de prueba, en la base de datos indicada
+func newTestRedisBackend(t *testing.T, server *miniredis.Miniredis, password string, db int) *RedisBackend {
+	t.Helper()
+	backend, err := NewRedisBackend(fmt.Sprintf("redis://:%s@%s/%d", password, server.Addr(), db), "img:", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestRedisBackendStoreLoadDelete(t *testing.T) {
+	server := miniredis.RunT(t)
+	backend := newTestRedisBackend(t, server, "", 0)
+
+	meta := &EntryMeta{ContentType: "image/jpeg", SourceURL: "https://example.com/a.jpg", Size: 4}
+	if err := backend.Store("a.jpg", []byte("data"), meta, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	data, loaded, err := backend.Load("a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data" || loaded.SourceURL != meta.SourceURL {
+		t.Errorf("Load = %q, %+v", data, loaded)
+	}
+
+	if err := backend.Delete("a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := backend.Load("a.jpg"); err != ErrEntryNotFound {
+		t.Errorf("Load after Delete error = %v, want %v", err, ErrEntryNotFound)
+	}
+	if err := backend.Delete("a.jpg"); err != ErrEntryNotFound {
+		t.Errorf("second Delete error = %v, want %v", err, ErrEntryNotFound)
+	}
+}
+
+// TestRedisBackendExpiration verifica que ambas claves de una entrada expiren en Redis
+func TestRedisBackendExpiration(t *testing.T) {
+	server := miniredis.RunT(t)
+	backend := newTestRedisBackend(t, server, "", 0)
+
+	if err := backend.Store("a.jpg", []byte("data"), &EntryMeta{}, 90*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{backend.dataKey("a.jpg"), backend.metaKey("a.jpg")} {
+		if ttl := server.TTL(key); ttl != 90*time.Second {
+			t.Errorf("TTL(%s) = %v, want 90s", key, ttl)
+		}
+	}
+
+	server.FastForward(2 * time.Minute)
+	if _, _, err := backend.Load("a.jpg"); err != ErrEntryNotFound {
+		t.Errorf("Load after expiration error = %v, want %v", err, ErrEntryNotFound)
+	}
+}
+
+func TestRedisBackendScan(t *testing.T) {
+	server := miniredis.RunT(t)
+	backend := newTestRedisBackend(t, server, "", 0)
+
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("%d.jpg", i)
+		if err := backend.Store(key, []byte("data"), &EntryMeta{Size: int64(i)}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Las claves de otras aplicaciones en la misma base de datos se ignoran
+	server.Set("other:meta:x.jpg", "{}")
+
+	scanned := make(map[string]int64)
+	if err := backend.Scan(func(key string, size int64, meta *EntryMeta) {
+		scanned[key] = size
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 5 || scanned["3.jpg"] != 3 {
+		t.Errorf("Scan = %v, want 5 entries with their sizes", scanned)
+	}
+}
+
+func TestRedisBackendAuthAndSelect(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+
+	if _, err := NewRedisBackend(fmt.Sprintf("redis://:wrong@%s/0", server.Addr()), "img:", 1); err == nil {
+		t.Error("NewRedisBackend with a wrong password succeeded")
+	}
+	if _, err := NewRedisBackend(fmt.Sprintf("redis://%s/0", server.Addr()), "img:", 1); err == nil || !strings.Contains(err.Error(), "NOAUTH") {
+		t.Errorf("NewRedisBackend without password error = %v, want NOAUTH", err)
+	}
+
+	backend := newTestRedisBackend(t, server, "secret", 3)
+	if err := backend.Store("a.jpg", []byte("data"), &EntryMeta{}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if keys := server.DB(3).Keys(); len(keys) != 2 {
+		t.Errorf("keys in db 3 = %v, want the data and meta keys", keys)
+	}
+	if keys := server.DB(0).Keys(); len(keys) != 0 {
+		t.Errorf("keys in db 0 = %v, want none", keys)
+	}
+	if location := backend.Location(); location != "redis://"+server.Addr()+"/3" {
+		t.Errorf("Location = %s, want the address without credentials", location)
+	}
+}
+
+func TestNewRedisBackendInvalidURL(t *testing.T) {
+	for _, rawURL := range []string{"http://cache:6379", "redis://cache/x"} {
+		if _, err := NewRedisBackend(rawURL, "img:", 1); err == nil || !strings.Contains(err.Error(), "invalid redis URL") {
+			t.Errorf("NewRedisBackend(%q) error = %v, want an invalid URL error", rawURL, err)
+		}
+	}
+}
+
+// TestSharedBackendSkipsMemoryTier verifica que una purga hecha en otra réplica se vea de inmediato
+func TestSharedBackendSkipsMemoryTier(t *testing.T) {
+	server := miniredis.RunT(t)
+	replicaA := NewCacheManagerWithBackend(newTestRedisBackend(t, server, "", 0), time.Hour, 10)
+	replicaA.MemoryTier = NewMemoryTier(10)
+	replicaB := NewCacheManagerWithBackend(newTestRedisBackend(t, server, "", 0), time.Hour, 10)
+
+	if err := replicaA.SaveToCache("a.jpg", []byte("data"), time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := replicaA.GetCachedImage("a.jpg"); !found {
+		t.Fatal("entry not found after saving")
+	}
+
+	if purged := replicaB.Flush(); purged != 1 {
+		t.Fatalf("purged %d entries, want 1", purged)
+	}
+	if _, found := replicaA.GetCachedImage("a.jpg"); found {
+		t.Error("replica served an entry purged by another replica")
+	}
+	if stats, _ := replicaA.GetStats(); stats.Scope != "replica" {
+		t.Errorf("stats scope = %q, want replica", stats.Scope)
+	}
+}
+
+// TestSharedCleanupKeepsRenewedEntries verifica que la limpieza de una réplica no elimine
+// del backend una entrada que otra réplica renovó
+func TestSharedCleanupKeepsRenewedEntries(t *testing.T) {
+	server := miniredis.RunT(t)
+	replicaA := NewCacheManagerWithBackend(newTestRedisBackend(t, server, "", 0), time.Hour, 10)
+	replicaB := NewCacheManagerWithBackend(newTestRedisBackend(t, server, "", 0), time.Hour, 10)
+
+	// La réplica A la conoce expirada; la B la vuelve a guardar
+	if err := replicaA.SaveToCache("a.jpg", []byte("old"), -time.Minute, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := replicaB.SaveToCache("a.jpg", []byte("new"), time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := replicaA.CleanupOldFiles(); err != nil {
+		t.Fatal(err)
+	}
+	entry, found := replicaB.GetCachedImage("a.jpg")
+	if !found || string(entry.Data) != "new" {
+		t.Fatal("cleanup on one replica deleted an entry renewed by another")
+	}
+	if stats, _ := replicaA.GetStats(); stats.Entries != 0 {
+		t.Errorf("entries in the cleaned index = %d, want 0", stats.Entries)
+	}
+}
+
+// TestSharedPurgeTagsSeesOtherReplicas verifica que las purgas por etiqueta usen las
+// etiquetas agregadas por otras réplicas a entradas que ya estaban indexadas
+func TestSharedPurgeTagsSeesOtherReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+	replicaA := NewCacheManagerWithBackend(newTestRedisBackend(t, server, "", 0), time.Hour, 10)
+	replicaB := NewCacheManagerWithBackend(newTestRedisBackend(t, server, "", 0), time.Hour, 10)
+
+	if err := replicaA.SaveToCache("a.jpg", []byte("data"), time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	// La réplica B indexa la entrada sin etiquetas al leerla
+	if _, found := replicaB.GetCachedImage("a.jpg"); !found {
+		t.Fatal("entry not found on the other replica")
+	}
+
+	entry, _ := replicaA.GetCachedImage("a.jpg")
+	if _, err := replicaA.SetTags("a.jpg", entry, []string{"product-42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if purged := replicaB.PurgeTags([]string{"product-42"}); purged != 1 {
+		t.Errorf("purged %d entries by a tag set on another replica, want 1", purged)
+	}
+	if _, found := replicaA.GetCachedImage("a.jpg"); found {
+		t.Error("entry still cached after the purge")
+	}
+}
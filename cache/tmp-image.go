@@ -1,190 +1,387 @@
 package cache
 
 import (
-	"crypto/md5"
+	"crypto/sha256"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type CacheManager struct {
-	CacheDir      string
-	CacheDuration time.Duration
-	MaxCacheSize  int64 // en bytes
+	CacheDir             string // directorio del backend en disco; vacío con otros backends
+	CacheDuration        time.Duration
+	MaxCacheSize         int64 // en bytes
+	TTLPolicy            *TTLPolicy
+	StaleWhileRevalidate time.Duration // ventana para servir contenido expirado mientras se refresca
+	StaleIfError         time.Duration // ventana para servir contenido expirado si el origen falla
+	MemoryTier           *MemoryTier   // tier en memoria para variantes frecuentes; nil = deshabilitado
+	backend              Backend       // almacenamiento de las entradas
+	index                *cacheIndex   // índice en memoria de las entradas del backend
 }
 
-// NewCacheManager crea una nueva instancia del gestor de cache
+// EntryState indica si una entrada puede servirse directamente o sólo como contenido stale
+type EntryState int
+
+const (
+	EntryFresh        EntryState = iota // no ha expirado
+	EntryStale                          // expirada, dentro de la ventana stale-while-revalidate
+	EntryStaleIfError                   // expirada, servible sólo si el origen falla
+)
+
+// CacheEntry es una entrada leída del caché
+type CacheEntry struct {
+	Data  []byte
+	Meta  *EntryMeta
+	State EntryState
+}
+
+// NewCacheManager crea una nueva instancia del gestor de cache sobre un directorio local
 func NewCacheManager(cacheDir string, cacheDuration time.Duration, maxCacheSizeMB int) *CacheManager {
-	// Crear directorio de cache si no existe
-	os.MkdirAll(cacheDir, 0755)
+	cm := NewCacheManagerWithBackend(NewDiskBackend(cacheDir, cacheDuration), cacheDuration, maxCacheSizeMB)
+	cm.CacheDir = cacheDir
+	return cm
+}
 
-	return &CacheManager{
-		CacheDir:      cacheDir,
+// NewCacheManagerWithBackend crea el gestor de cache sobre el backend indicado
+func NewCacheManagerWithBackend(backend Backend, cacheDuration time.Duration, maxCacheSizeMB int) *CacheManager {
+	cm := &CacheManager{
 		CacheDuration: cacheDuration,
 		MaxCacheSize:  int64(maxCacheSizeMB) * 1024 * 1024, // convertir MB a bytes
+		TTLPolicy:     NewTTLPolicy(cacheDuration, 0, 0),
+		backend:       backend,
+		index:         newCacheIndex(),
 	}
+
+	// Reconstruir el índice a partir de las entradas existentes
+	if err := cm.syncIndex(); err != nil {
+		fmt.Printf("Warning: failed to index cache entries: %v\n", err)
+	}
+	return cm
 }
 
-// GenerateCacheKey genera una clave única para el cache basada en los parámetros
-func (cm *CacheManager) GenerateCacheKey(url string, width int, quality int) string {
-	data := fmt.Sprintf("%s_%d_%d", url, width, quality)
-	hash := md5.Sum([]byte(data))
-	return fmt.Sprintf("%x.jpg", hash)
+// syncIndex registra en el índice las entradas del backend que aún no conoce.
+// Los aciertos y el último acceso se restauran de los metadatos; las entradas que no
+// los guardan parten de su fecha de creación. Con un backend compartido también se
+// vuelven a leer las entradas conocidas, porque otra réplica pudo renovarlas o cambiar
+// sus etiquetas, y se olvidan las que ya no están en el backend.
+func (cm *CacheManager) syncIndex() error {
+	shared := cm.backend.Shared()
+	found := make(map[string]bool)
+	err := cm.backend.Scan(func(key string, size int64, meta *EntryMeta) {
+		found[key] = true
+		if shared || !cm.index.has(key) {
+			cm.index.add(key, size, meta.CreatedAt, meta)
+		}
+	})
+	if err != nil || !shared {
+		return err
+	}
+	for _, key := range cm.index.keysWhere(func(string) bool { return true }) {
+		if !found[key] {
+			cm.index.remove(key)
+		}
+	}
+	return nil
 }
 
-// GetCachedImage verifica si existe una imagen en cache y si no ha expirado
-func (cm *CacheManager) GetCachedImage(cacheKey string) ([]byte, bool) {
-	cachePath := filepath.Join(cm.CacheDir, cacheKey)
+// GenerateCacheKey genera el nombre de archivo de una entrada a partir de la
+// serialización canónica de sus parámetros y la extensión de su formato
+func (cm *CacheManager) GenerateCacheKey(canonical string, format string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	ext := format
+	if ext == "" || ext == "jpeg" {
+		ext = "jpg"
+	}
+	return fmt.Sprintf("%x.%s", hash, ext)
+}
 
-	// Verificar si el archivo existe
-	fileInfo, err := os.Stat(cachePath)
-	if err != nil {
-		return nil, false
+// GetCachedImage busca una imagen en cache. Las entradas expiradas se retornan
+// mientras sigan dentro de alguna ventana de gracia, indicando su estado.
+func (cm *CacheManager) GetCachedImage(cacheKey string) (*CacheEntry, bool) {
+	// Consultar primero el tier en memoria
+	if data, meta, ok := cm.memory().get(cacheKey); ok {
+		if state, servable := cm.entryState(meta, time.Now()); servable {
+			cm.index.touch(cacheKey, time.Now())
+			return &CacheEntry{Data: data, Meta: meta, State: state}, true
+		}
+		cm.memory().remove(cacheKey)
 	}
 
-	// Verificar si el archivo no ha expirado
-	if time.Since(fileInfo.ModTime()) > cm.CacheDuration {
-		// Archivo expirado, eliminarlo
-		os.Remove(cachePath)
+	data, meta, err := cm.backend.Load(cacheKey)
+	if err != nil {
+		if !errors.Is(err, ErrEntryNotFound) {
+			fmt.Printf("Warning: failed to read cache entry %s: %v\n", cacheKey, err)
+		}
+		// La entrada pudo eliminarse fuera del servidor o expirar en el backend
+		cm.index.remove(cacheKey)
 		return nil, false
 	}
 
-	// Leer el archivo
-	data, err := os.ReadFile(cachePath)
-	if err != nil {
+	// Determinar el estado de la entrada
+	now := time.Now()
+	state, servable := cm.entryState(meta, now)
+	if !servable {
+		// Fuera de todas las ventanas de gracia, eliminarla
+		cm.removeEntry(cacheKey)
 		return nil, false
 	}
 
-	return data, true
-}
+	// Las entradas anteriores a los metadatos extendidos se completan a partir del contenido
+	meta.Fill(data)
 
-// SaveToCache guarda una imagen en el cache
-func (cm *CacheManager) SaveToCache(cacheKey string, data []byte) error {
-	// Verificar espacio disponible antes de guardar
-	if err := cm.cleanupIfNeeded(int64(len(data))); err != nil {
-		return err
+	// Registrar el acceso (o la entrada, si la guardó otra réplica) y promoverla al tier en memoria
+	if !cm.index.touch(cacheKey, now) {
+		cm.index.add(cacheKey, int64(len(data)), now, meta)
 	}
+	cm.memory().put(cacheKey, data, meta)
 
-	cachePath := filepath.Join(cm.CacheDir, cacheKey)
-	return os.WriteFile(cachePath, data, 0644)
+	return &CacheEntry{Data: data, Meta: meta, State: state}, true
 }
 
-// cleanupIfNeeded limpia archivos antiguos si es necesario para hacer espacio
-func (cm *CacheManager) cleanupIfNeeded(newFileSize int64) error {
-	currentSize, err := cm.getCacheSize()
-	if err != nil {
-		return err
+// entryState determina el estado de una entrada; servable es false si ya no puede servirse
+func (cm *CacheManager) entryState(meta *EntryMeta, now time.Time) (state EntryState, servable bool) {
+	switch {
+	case !meta.IsExpired(now):
+		return EntryFresh, true
+	case now.Before(meta.ExpiresAt.Add(cm.StaleWhileRevalidate)):
+		return EntryStale, true
+	case now.Before(meta.ExpiresAt.Add(cm.StaleIfError)):
+		return EntryStaleIfError, true
+	default:
+		return 0, false
 	}
+}
 
-	if currentSize+newFileSize <= cm.MaxCacheSize {
-		return nil // No necesita limpieza
+// CacheControl deriva el header Cache-Control con el que se sirve una entrada: el tiempo que
+// le queda antes de expirar, stale-while-revalidate si se sirve expirada mientras se refresca,
+// y private/no-store si el origen prohibió almacenarla
+func (cm *CacheManager) CacheControl(meta *EntryMeta, now time.Time) string {
+	if meta.NoStore {
+		return "private, no-store"
 	}
-
-	// Obtener lista de archivos ordenados por fecha de modificación
-	files, err := cm.getCacheFilesSorted()
-	if err != nil {
-		return err
+	if remaining := meta.ExpiresAt.Sub(now); remaining > 0 {
+		return fmt.Sprintf("public, max-age=%d", int64(remaining/time.Second))
+	}
+	if window := meta.ExpiresAt.Add(cm.StaleWhileRevalidate).Sub(now); window > 0 {
+		return fmt.Sprintf("public, max-age=0, stale-while-revalidate=%d", int64(window/time.Second))
 	}
+	// Servida por stale-if-error: no debe reutilizarse sin volver a pedirla
+	return "public, max-age=0, must-revalidate"
+}
 
-	// Eliminar archivos más antiguos hasta tener espacio suficiente
-	for _, file := range files {
-		if currentSize+newFileSize <= cm.MaxCacheSize {
-			break
+// SaveToCache guarda una imagen en el cache junto con sus metadatos.
+// meta puede ser nil; las fechas, el tamaño y el ETag se completan aquí.
+func (cm *CacheManager) SaveToCache(cacheKey string, data []byte, ttl time.Duration, meta *EntryMeta) error {
+	// Verificar espacio disponible antes de guardar. Los backends compartidos
+	// administran su propia capacidad (por ejemplo, maxmemory en Redis).
+	if !cm.backend.Shared() {
+		if err := cm.cleanupIfNeeded(int64(len(data))); err != nil {
+			return err
 		}
+	}
 
-		filePath := filepath.Join(cm.CacheDir, file.Name())
-		fileSize := file.Size()
+	if meta == nil {
+		meta = &EntryMeta{}
+	}
+	now := time.Now()
+	meta.CreatedAt = now
+	meta.ExpiresAt = now.Add(ttl)
+	meta.Fill(data)
+
+	// Conservar los contadores de la entrada que se reemplaza; los de otra réplica no aplican
+	meta.Hits, meta.LastAccess = 0, time.Time{}
+	if hits, accessedAt, ok := cm.index.access(cacheKey); ok {
+		meta.Hits, meta.LastAccess = hits, accessedAt
+	}
 
-		if err := os.Remove(filePath); err == nil {
-			currentSize -= fileSize
-		}
+	if err := cm.backend.Store(cacheKey, data, meta, ttl+cm.gracePeriod()); err != nil {
+		return err
 	}
 
+	cm.index.add(cacheKey, int64(len(data)), now, meta)
+	cm.memory().put(cacheKey, data, meta)
 	return nil
 }
 
-// getCacheSize calcula el tamaño total del cache
-func (cm *CacheManager) getCacheSize() (int64, error) {
-	var totalSize int64
+// SetTags reemplaza las etiquetas de una entrada existente conservando su contenido y
+// expiración, y la vuelve a indexar. Retorna los metadatos actualizados.
+func (cm *CacheManager) SetTags(cacheKey string, entry *CacheEntry, tags []string) (*EntryMeta, error) {
+	meta := *entry.Meta
+	meta.Tags = tags
 
-	err := filepath.Walk(cm.CacheDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			totalSize += info.Size()
-		}
-		return nil
-	})
+	retain := time.Until(meta.ExpiresAt) + cm.gracePeriod()
+	if retain <= 0 {
+		return entry.Meta, nil
+	}
+	if err := cm.backend.Store(cacheKey, entry.Data, &meta, retain); err != nil {
+		return entry.Meta, err
+	}
 
-	return totalSize, err
+	cm.index.add(cacheKey, int64(len(entry.Data)), time.Now(), &meta)
+	cm.memory().put(cacheKey, entry.Data, &meta)
+	return &meta, nil
 }
 
-// getCacheFilesSorted obtiene archivos del cache ordenados por fecha de modificación (más antiguos primero)
-func (cm *CacheManager) getCacheFilesSorted() ([]os.FileInfo, error) {
-	files, err := os.ReadDir(cm.CacheDir)
-	if err != nil {
-		return nil, err
+// memory retorna el tier en memoria, o nil si está deshabilitado. Con backends compartidos
+// no se usa: las invalidaciones hechas en otra réplica no lo alcanzarían.
+func (cm *CacheManager) memory() *MemoryTier {
+	if cm.backend.Shared() {
+		return nil
 	}
+	return cm.MemoryTier
+}
 
-	var fileInfos []os.FileInfo
-	for _, file := range files {
-		if !file.IsDir() {
-			info, err := file.Info()
-			if err == nil {
-				fileInfos = append(fileInfos, info)
-			}
-		}
+// gracePeriod retorna la mayor de las ventanas de gracia configuradas
+func (cm *CacheManager) gracePeriod() time.Duration {
+	if cm.StaleIfError > cm.StaleWhileRevalidate {
+		return cm.StaleIfError
 	}
+	return cm.StaleWhileRevalidate
+}
 
-	// Ordenar por fecha de modificación (más antiguos primero)
-	for i := 0; i < len(fileInfos)-1; i++ {
-		for j := i + 1; j < len(fileInfos); j++ {
-			if fileInfos[i].ModTime().After(fileInfos[j].ModTime()) {
-				fileInfos[i], fileInfos[j] = fileInfos[j], fileInfos[i]
-			}
-		}
-	}
+// removeEntry elimina una entrada del backend, del índice y del tier en memoria
+func (cm *CacheManager) removeEntry(cacheKey string) error {
+	cm.index.remove(cacheKey)
+	cm.memory().remove(cacheKey)
+	return cm.backend.Delete(cacheKey)
+}
 
-	return fileInfos, nil
+// cleanupIfNeeded desaloja las entradas menos usadas si es necesario para hacer espacio
+func (cm *CacheManager) cleanupIfNeeded(newFileSize int64) error {
+	for _, key := range cm.index.evict(newFileSize, cm.MaxCacheSize) {
+		cm.removeEntry(key)
+	}
+	return nil
 }
 
 // SaveImageToCache es un alias para SaveToCache para compatibilidad
-func (cm *CacheManager) SaveImageToCache(cacheKey string, data []byte) error {
-	return cm.SaveToCache(cacheKey, data)
+func (cm *CacheManager) SaveImageToCache(cacheKey string, data []byte, ttl time.Duration, meta *EntryMeta) error {
+	return cm.SaveToCache(cacheKey, data, ttl, meta)
 }
 
 // GetCacheSize retorna el tamaño actual del caché
 func (cm *CacheManager) GetCacheSize() string {
-	size, err := cm.getCacheSize()
-	if err != nil {
-		return "unknown"
+	return fmt.Sprintf("%.2f MB", float64(cm.index.size())/(1024*1024))
+}
+
+// CacheStats resume el contenido del caché a partir de los metadatos de cada entrada
+type CacheStats struct {
+	Policy        string         `json:"policy"` // política de desalojo
+	Hits          int64          `json:"hits"`   // aciertos acumulados por las entradas actuales
+	Entries       int            `json:"entries"`
+	Bytes         int64          `json:"bytes"`          // tamaño total de las variantes
+	OriginalBytes int64          `json:"original_bytes"` // tamaño total de los originales de las variantes
+	Expired       int            `json:"expired"`        // entradas expiradas que aún pueden servirse como stale
+	ContentTypes  map[string]int `json:"content_types"`  // entradas por content type
+	Memory        *MemoryStats   `json:"memory,omitempty"`
+	Scope         string         `json:"scope"` // "backend": todo el caché; "replica": sólo las entradas conocidas por esta réplica
+}
+
+// GetStats retorna las estadísticas del caché a partir del índice, sin acceder al disco.
+// Con un backend compartido el índice sólo contiene las entradas que esta réplica guardó o
+// leyó, así que las estadísticas son por réplica.
+func (cm *CacheManager) GetStats() (*CacheStats, error) {
+	stats := cm.index.stats(time.Now())
+	stats.Memory = cm.memory().stats()
+	stats.Scope = "backend"
+	if cm.backend.Shared() {
+		stats.Scope = "replica"
 	}
-	return fmt.Sprintf("%.2f MB", float64(size)/(1024*1024))
+	return stats, nil
+}
+
+// PurgeKey elimina una entrada; retorna false si no existía
+func (cm *CacheManager) PurgeKey(cacheKey string) bool {
+	return cm.removeEntry(cacheKey) == nil
 }
 
-// GetCacheDir retorna el directorio del caché
+// PurgeWhere elimina las entradas cuya URL de origen cumple la condición y retorna cuántas eliminó.
+// Las entradas sin URL de origen registrada (anteriores a los metadatos extendidos) sólo se eliminan con Flush.
+func (cm *CacheManager) PurgeWhere(match func(sourceURL string) bool) int {
+	cm.syncSharedIndex()
+	keys := cm.index.keysWhere(func(sourceURL string) bool {
+		return sourceURL != "" && match(sourceURL)
+	})
+	for _, key := range keys {
+		cm.removeEntry(key)
+	}
+	return len(keys)
+}
+
+// PurgeTags elimina las entradas que tienen alguna de las etiquetas y retorna cuántas eliminó
+func (cm *CacheManager) PurgeTags(tags []string) int {
+	cm.syncSharedIndex()
+	keys := cm.index.keysWithTags(tags)
+	for _, key := range keys {
+		cm.removeEntry(key)
+	}
+	return len(keys)
+}
+
+// Flush elimina todas las entradas del caché y retorna cuántas eliminó
+func (cm *CacheManager) Flush() int {
+	cm.syncSharedIndex()
+	keys := cm.index.keysWhere(func(string) bool { return true })
+	for _, key := range keys {
+		cm.removeEntry(key)
+	}
+	return len(keys)
+}
+
+// syncSharedIndex incorpora al índice las entradas guardadas por otras réplicas,
+// para que las invalidaciones alcancen a todo el backend compartido
+func (cm *CacheManager) syncSharedIndex() {
+	if !cm.backend.Shared() {
+		return
+	}
+	if err := cm.syncIndex(); err != nil {
+		fmt.Printf("Warning: failed to sync cache index: %v\n", err)
+	}
+}
+
+// SetEvictionPolicy cambia la política con la que se desalojan entradas cuando el caché se llena
+func (cm *CacheManager) SetEvictionPolicy(policy EvictionPolicy) {
+	cm.index.setPolicy(policy)
+}
+
+// GetCacheDir retorna la ubicación del caché (directorio o URL del backend)
 func (cm *CacheManager) GetCacheDir() string {
-	return cm.CacheDir
+	return cm.backend.Location()
 }
 
-// CleanupOldFiles limpia archivos expirados del caché
+// CleanupOldFiles limpia archivos expirados del caché que ya no pueden servirse como stale
+// (con un backend compartido sólo los olvida en el índice) y guarda los contadores de
+// acceso de las entradas usadas desde la última limpieza
 func (cm *CacheManager) CleanupOldFiles() error {
-	files, err := cm.getCacheFilesSorted()
-	if err != nil {
-		return err
+	cutoff := time.Now().Add(-cm.gracePeriod())
+	for _, key := range cm.index.expiredBefore(cutoff) {
+		if cm.backend.Shared() {
+			// Otra réplica pudo renovar la entrada; si no, el backend la expira por sí mismo
+			cm.index.remove(key)
+			continue
+		}
+		cm.removeEntry(key)
 	}
+	cm.persistAccess()
+	return nil
+}
 
-	for _, file := range files {
-		if time.Since(file.ModTime()) > cm.CacheDuration {
-			filePath := filepath.Join(cm.CacheDir, file.Name())
-			os.Remove(filePath)
+// persistAccess guarda en los metadatos los aciertos y el último acceso de las entradas,
+// para restaurarlos al reconstruir el índice. Con backends que no lo soportan los
+// contadores se guardan sólo cuando la entrada se vuelve a almacenar.
+func (cm *CacheManager) persistAccess() {
+	recorder, ok := cm.backend.(accessRecorder)
+	if !ok {
+		return
+	}
+	for _, record := range cm.index.takeDirty() {
+		if err := recorder.recordAccess(record.key, record.hits, record.accessedAt); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("Warning: failed to save access counters for %s: %v\n", record.key, err)
 		}
 	}
-	return nil
 }
 
 // ParseCacheDuration convierte string de duración a time.Duration
@@ -212,6 +409,9 @@ func ParseCacheDuration(duration string) time.Duration {
 	if err != nil {
 		return time.Hour // default en caso de error
 	}
+	if value == 0 {
+		return 0 // "0" desactiva el valor, con o sin unidad
+	}
 
 	switch unit {
 	case "min":
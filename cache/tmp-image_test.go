@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCacheControl verifica que el Cache-Control de la respuesta siga la expiración de la entrada
+func TestCacheControl(t *testing.T) {
+	now := time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC)
+	cm := &CacheManager{StaleWhileRevalidate: time.Hour, StaleIfError: 24 * time.Hour}
+
+	tests := []struct {
+		name string
+		meta *EntryMeta
+		want string
+	}{
+		{"fresh", &EntryMeta{ExpiresAt: now.Add(10 * time.Minute)}, "public, max-age=600"},
+		{"stale while revalidating", &EntryMeta{ExpiresAt: now.Add(-20 * time.Minute)}, "public, max-age=0, stale-while-revalidate=2400"},
+		{"stale if error", &EntryMeta{ExpiresAt: now.Add(-2 * time.Hour)}, "public, max-age=0, must-revalidate"},
+		{"no-store origin", &EntryMeta{ExpiresAt: now.Add(time.Hour), NoStore: true}, "private, no-store"},
+	}
+	for _, test := range tests {
+		if got := cm.CacheControl(test.meta, now); got != test.want {
+			t.Errorf("%s: CacheControl = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
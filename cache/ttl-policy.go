@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TTLPolicy calcula el TTL de cada entrada a partir de los headers del origen
+type TTLPolicy struct {
+	DefaultTTL time.Duration // usado cuando el origen no indica expiración
+	MinTTL     time.Duration
+	MaxTTL     time.Duration // 0 = sin límite superior
+}
+
+// NewTTLPolicy crea una nueva política de TTL
+func NewTTLPolicy(defaultTTL, minTTL, maxTTL time.Duration) *TTLPolicy {
+	return &TTLPolicy{
+		DefaultTTL: defaultTTL,
+		MinTTL:     minTTL,
+		MaxTTL:     maxTTL,
+	}
+}
+
+// TTLFromHeaders deriva el TTL de Cache-Control (s-maxage, max-age, no-store, no-cache) y Expires.
+// Retorna false si la respuesta no debe almacenarse en caché.
+func (p *TTLPolicy) TTLFromHeaders(header http.Header, now time.Time) (time.Duration, bool) {
+	if header == nil {
+		return p.clamp(p.DefaultTTL), true
+	}
+
+	directives := parseCacheControl(header.Values("Cache-Control"))
+
+	// Somos una caché compartida: no-store y private impiden almacenar
+	if _, ok := directives["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := directives["private"]; ok {
+		return 0, false
+	}
+
+	// no-cache permite almacenar pero exige revalidar antes de cada uso: la entrada nace
+	// expirada, sin aplicar MinTTL
+	if arg, ok := directives["no-cache"]; ok && arg == "" {
+		return 0, true
+	}
+
+	// s-maxage tiene prioridad sobre max-age para cachés compartidas
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+				ttl := time.Duration(seconds)*time.Second - parseAge(header)
+				return p.clamp(ttl), true
+			}
+		}
+	}
+
+	// Expires se evalúa respecto al header Date del origen si existe
+	if expires := header.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			// Un Expires inválido equivale a una respuesta ya expirada
+			return p.clamp(0), true
+		}
+		base := now
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			base = date
+		}
+		return p.clamp(expiresAt.Sub(base)), true
+	}
+
+	return p.clamp(p.DefaultTTL), true
+}
+
+// clamp limita el TTL entre MinTTL y MaxTTL
+func (p *TTLPolicy) clamp(ttl time.Duration) time.Duration {
+	if ttl < p.MinTTL {
+		ttl = p.MinTTL
+	}
+	if p.MaxTTL > 0 && ttl > p.MaxTTL {
+		ttl = p.MaxTTL
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return ttl
+}
+
+// parseCacheControl convierte los headers Cache-Control en un mapa de directivas
+func parseCacheControl(values []string) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, arg, _ := strings.Cut(part, "=")
+			directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+	return directives
+}
+
+// parseAge obtiene el header Age como duración
+func parseAge(header http.Header) time.Duration {
+	age, err := strconv.ParseInt(strings.TrimSpace(header.Get("Age")), 10, 64)
+	if err != nil || age < 0 {
+		return 0
+	}
+	return time.Duration(age) * time.Second
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestTTLFromHeaders verifica la prioridad de s-maxage, max-age y Expires, los límites y no-store/private
+func TestTTLFromHeaders(t *testing.T) {
+	now := time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC)
+	policy := NewTTLPolicy(time.Hour, time.Minute, 24*time.Hour)
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		ttl       time.Duration
+		cacheable bool
+	}{
+		{"no headers", http.Header{}, time.Hour, true},
+		{"nil header", nil, time.Hour, true},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=600"}}, 10 * time.Minute, true},
+		{"s-maxage over max-age", http.Header{"Cache-Control": {"max-age=600, s-maxage=1200"}}, 20 * time.Minute, true},
+		{"max-age over Expires", http.Header{
+			"Cache-Control": {"max-age=600"},
+			"Expires":       {now.Add(2 * time.Hour).Format(http.TimeFormat)},
+		}, 10 * time.Minute, true},
+		{"max-age minus Age", http.Header{"Cache-Control": {"max-age=600"}, "Age": {"300"}}, 5 * time.Minute, true},
+		{"Expires relative to Date", http.Header{
+			"Date":    {now.Add(-time.Hour).Format(http.TimeFormat)},
+			"Expires": {now.Add(time.Hour).Format(http.TimeFormat)},
+		}, 2 * time.Hour, true},
+		{"Expires relative to now", http.Header{"Expires": {now.Add(30 * time.Minute).Format(http.TimeFormat)}}, 30 * time.Minute, true},
+		{"invalid Expires", http.Header{"Expires": {"0"}}, time.Minute, true},
+		{"clamped to MinTTL", http.Header{"Cache-Control": {"max-age=5"}}, time.Minute, true},
+		{"clamped to MaxTTL", http.Header{"Cache-Control": {"max-age=31536000"}}, 24 * time.Hour, true},
+		{"invalid max-age falls back to the default", http.Header{"Cache-Control": {"max-age=abc"}}, time.Hour, true},
+		{"no-store", http.Header{"Cache-Control": {"no-store, max-age=600"}}, 0, false},
+		{"private", http.Header{"Cache-Control": {"private, max-age=600"}}, 0, false},
+		{"directives split across headers", http.Header{"Cache-Control": {"public", "PRIVATE"}}, 0, false},
+		{"no-cache expires immediately", http.Header{"Cache-Control": {"no-cache, max-age=600"}}, 0, true},
+		{"no-cache with fields is ignored", http.Header{"Cache-Control": {`no-cache="Set-Cookie", max-age=600`}}, 10 * time.Minute, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ttl, cacheable := policy.TTLFromHeaders(test.header, now)
+			if ttl != test.ttl || cacheable != test.cacheable {
+				t.Errorf("TTLFromHeaders = %v, %v; want %v, %v", ttl, cacheable, test.ttl, test.cacheable)
+			}
+		})
+	}
+
+	// Sin MaxTTL no hay límite superior
+	unbounded := NewTTLPolicy(time.Hour, 0, 0)
+	if ttl, _ := unbounded.TTLFromHeaders(http.Header{"Cache-Control": {"max-age=31536000"}}, now); ttl != 365*24*time.Hour {
+		t.Errorf("unbounded TTL = %v, want a year", ttl)
+	}
+}
+
+// TestParseCacheDuration verifica las unidades y que "0" desactive el valor
+func TestParseCacheDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30min": 30 * time.Minute,
+		"2h":    2 * time.Hour,
+		"1d":    24 * time.Hour,
+		"0":     0,
+		"0min":  0,
+		"0d":    0,
+		"":      time.Hour,
+		"abc":   time.Hour,
+		"5x":    time.Hour,
+	}
+	for value, want := range tests {
+		if got := ParseCacheDuration(value); got != want {
+			t.Errorf("ParseCacheDuration(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
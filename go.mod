@@ -10,4 +10,15 @@ require (
 
 require golang.org/x/image v0.29.0
 
-require github.com/go-chi/cors v1.2.2 // indirect
+require (
+	github.com/alicebob/miniredis/v2 v2.39.0
+	github.com/go-chi/cors v1.2.2
+	github.com/redis/go-redis/v9 v9.22.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
@@ -0,0 +1,191 @@
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/url"
+
+	"github.com/loxzer01/serve-img-optimized/cache"
+)
+
+// maxBatchVariants limita las variantes que se pueden generar en una sola petición
+const maxBatchVariants = 20
+
+// BatchRequest describe las variantes a generar a partir de una única imagen de origen
+type BatchRequest struct {
+	URL             string   `json:"url"` // URL, @alias/ruta o fuente con prefijo (local:/, s3:/)
+	Origin          string   `json:"origin,omitempty"`
+	Transformations []string `json:"transformations,omitempty"` // ["w_400,q_90", "w_800,f_png"]
+	Presets         []string `json:"presets,omitempty"`
+	Tags            []string `json:"tags,omitempty"` // etiquetas para invalidar las variantes en grupo
+}
+
+// BatchVariant describe una variante generada
+type BatchVariant struct {
+	Transform string `json:"transform"`
+	Preset    string `json:"preset,omitempty"`
+	URL       string `json:"url"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Bytes     int    `json:"bytes"`
+	Format    string `json:"format"`
+	Cached    bool   `json:"cached"` // true si ya estaba en caché y no se regeneró
+}
+
+// BatchResult es el manifiesto de las variantes producidas
+type BatchResult struct {
+	Source   string         `json:"source"`
+	ServedBy string         `json:"served_by,omitempty"` // URL que sirvió el original si hubo que descargarlo
+	Variants []BatchVariant `json:"variants"`
+}
+
+// batchItem agrupa los parámetros de una variante con su resultado
+type batchItem struct {
+	params   *ImageParams
+	preset   string
+	cacheKey string
+	variant  *BatchVariant
+}
+
+// GenerateVariants produce todas las variantes solicitadas con una sola descarga y decodificación.
+// Las variantes que ya están frescas en caché no se regeneran.
+func (io *ImageOptimizer) GenerateVariants(req *BatchRequest) (*BatchResult, error) {
+	items, source, err := io.parseBatch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{Source: source.URL}
+
+	// Reutilizar las variantes frescas del caché
+	var pending []*batchItem
+	for _, item := range items {
+		entry, found := io.cacheManager.GetCachedImage(item.cacheKey)
+		if found {
+			io.tagEntry(item.cacheKey, entry, item.params.Tags)
+		}
+		if found && entry.State == cache.EntryFresh {
+			// Las entradas con metadatos no necesitan decodificarse para conocer sus dimensiones
+			if entry.Meta.Width > 0 && entry.Meta.Height > 0 {
+				item.variant = newBatchVariant(item, entry.Data, entry.Meta.Width, entry.Meta.Height, true)
+				continue
+			}
+			if config, _, err := image.DecodeConfig(bytes.NewReader(entry.Data)); err == nil {
+				item.variant = newBatchVariant(item, entry.Data, config.Width, config.Height, true)
+				continue
+			}
+		}
+		pending = append(pending, item)
+	}
+
+	if len(pending) > 0 {
+		// Una única descarga y decodificación para todas las variantes pendientes
+		fetched, err := io.fetchOriginal(source)
+		if err != nil {
+			return nil, fmt.Errorf("download error: %w", err)
+		}
+		result.ServedBy = fetched.ServedBy
+		img, err := io.processor.DecodeImage(fetched.Data)
+		if err != nil {
+			return nil, fmt.Errorf("processing error: %v", err)
+		}
+
+		for _, item := range pending {
+			data, size, err := io.processor.EncodeVariant(img, item.params.Width, item.params.Quality, item.params.Format)
+			if err != nil {
+				return nil, fmt.Errorf("processing error: %v", err)
+			}
+			io.saveVariant(item.cacheKey, data, fetched.Header, variantMeta(item.params, fetched, size))
+			item.variant = newBatchVariant(item, data, size.X, size.Y, false)
+		}
+	}
+
+	for _, item := range items {
+		result.Variants = append(result.Variants, *item.variant)
+	}
+	return result, nil
+}
+
+// ValidateBatch valida una petición batch sin descargar la imagen
+func (io *ImageOptimizer) ValidateBatch(req *BatchRequest) error {
+	_, _, err := io.parseBatch(req)
+	return err
+}
+
+// parseBatch valida la petición y construye los parámetros de cada variante
+func (io *ImageOptimizer) parseBatch(req *BatchRequest) ([]*batchItem, *ImageParams, error) {
+	total := len(req.Transformations) + len(req.Presets)
+	if total == 0 {
+		return nil, nil, fmt.Errorf("%w: at least one transformation or preset is required", ErrInvalidParams)
+	}
+	if total > maxBatchVariants {
+		return nil, nil, fmt.Errorf("%w: at most %d variants per request", ErrInvalidParams, maxBatchVariants)
+	}
+
+	source := io.paramsParser.GetDefaultParams()
+	if err := io.paramsParser.ParseSource(source, req.URL, req.Origin); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	if err := io.checkOrigin(source); err != nil {
+		return nil, nil, err
+	}
+	tags, err := ParseTags(req.Tags)
+	if err != nil {
+		return nil, nil, err
+	}
+	source.Tags = tags
+
+	var items []*batchItem
+	addItem := func(params *ImageParams, preset string) {
+		params.URL, params.Origin, params.Alias = source.URL, source.Origin, source.Alias
+		params.Mirrors, params.Ref, params.Tags = source.Mirrors, source.Ref, source.Tags
+		items = append(items, &batchItem{
+			params:   params,
+			preset:   preset,
+			cacheKey: io.cacheManager.GenerateCacheKey(params.CacheKey(), params.Format),
+		})
+	}
+
+	for _, spec := range req.Transformations {
+		params, err := io.paramsParser.ParseTransformations(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		addItem(params, "")
+	}
+	for _, name := range req.Presets {
+		params, err := io.paramsParser.ParsePreset(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		addItem(params, name)
+	}
+
+	return items, source, nil
+}
+
+// newBatchVariant construye la descripción de una variante
+func newBatchVariant(item *batchItem, data []byte, width, height int, cached bool) *BatchVariant {
+	return &BatchVariant{
+		Transform: item.params.TransformString(),
+		Preset:    item.preset,
+		URL:       VariantURL(item.params),
+		Width:     width,
+		Height:    height,
+		Bytes:     len(data),
+		Format:    item.params.Format,
+		Cached:    cached,
+	}
+}
+
+// VariantURL construye la URL relativa de GET /api/image que sirve la variante.
+// La referencia se escapa como ruta para que "?", "#", "%" o espacios no alteren la petición.
+func VariantURL(params *ImageParams) string {
+	ref := (&url.URL{Path: params.Ref}).EscapedPath()
+	variantURL := "/api/image/" + params.TransformString() + "/" + ref
+	if params.Origin != "" {
+		variantURL += "?origin=" + url.QueryEscape(params.Origin)
+	}
+	return variantURL
+}
@@ -0,0 +1,46 @@
+package images
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestVariantURLRoundTrip verifica que la URL de una variante vuelva a resolver la misma imagen
+func TestVariantURLRoundTrip(t *testing.T) {
+	parser := NewParamsParser(&Config{Aliases: map[string]*Alias{
+		"products": {Mirrors: []string{"https://cdn.shop.example/uploads/"}},
+	}})
+
+	refs := []string{
+		"example.com/a b.jpg?v=2",
+		"example.com/a%2Bb.jpg#top",
+		"@products/ñandú 1.jpg",
+		"https://example.com/img.png",
+	}
+
+	for _, ref := range refs {
+		t.Run(ref, func(t *testing.T) {
+			params, err := parser.ParsePath("w_400,q_80/"+ref, "mysite.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			variantURL, err := url.Parse(VariantURL(params))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := variantURL.Query().Get("origin"); got != "mysite.com" {
+				t.Errorf("origin = %q, want mysite.com", got)
+			}
+
+			parsed, err := parser.ParsePath(strings.TrimPrefix(variantURL.Path, "/api/image/"), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.URL != params.URL || parsed.TransformString() != params.TransformString() {
+				t.Errorf("round trip = %s %s, want %s %s", parsed.TransformString(), parsed.URL, params.TransformString(), params.URL)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package images
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrOriginNotAllowed indica que el parámetro origin no está permitido para el host
+var ErrOriginNotAllowed = errors.New("origin not allowed for this source host")
+
+// Config contiene la configuración de orígenes cargada desde CONFIG_FILE
+type Config struct {
+	Hosts                 map[string]*HostRule `json:"hosts"`
+	DefaultAllowedOrigins []string             `json:"default_allowed_origins"` // para hosts sin allowed_origins
+	Aliases               map[string]*Alias    `json:"aliases"`                 // prefijo corto -> URLs base
+	Transport             *TransportConfig     `json:"transport"`               // proxy y TLS para todos los orígenes
+	Presets               map[string]string    `json:"presets"`                 // nombre -> transformaciones ("w_400,q_90")
+	Breakpoints           map[string][]int     `json:"breakpoints"`             // nombre -> anchos para srcset
+}
+
+// Alias contiene las URLs base de un alias de origen.
+// La primera es la principal y las siguientes son mirrors de respaldo.
+type Alias struct {
+	Mirrors []string
+}
+
+// UnmarshalJSON acepta una URL base ("https://...") o una lista de mirrors (["https://...", ...])
+func (a *Alias) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		a.Mirrors = []string{single}
+		return nil
+	}
+	if err := json.Unmarshal(data, &a.Mirrors); err != nil {
+		return fmt.Errorf("alias must be a base URL or a list of mirror base URLs")
+	}
+	return nil
+}
+
+// HostRule define cómo se realizan las peticiones hacia un host de origen
+type HostRule struct {
+	Headers        map[string]string `json:"headers"`
+	Auth           *AuthConfig       `json:"auth"`
+	Timeout        Duration          `json:"timeout"`
+	ForwardOrigin  *bool             `json:"forward_origin"`
+	AllowedOrigins []string          `json:"allowed_origins"`
+	Transport      *TransportConfig  `json:"transport"` // sobrescribe la configuración global para este host
+	RateLimit      *RateLimitConfig  `json:"rate_limit"`
+}
+
+// AuthConfig contiene las credenciales para orígenes privados
+type AuthConfig struct {
+	Type     string `json:"type"` // basic | bearer
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+}
+
+// Duration permite expresar duraciones en JSON como "10s" o "1m30s"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parsea una duración en formato de Go
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string: %v", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", value, err)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// LoadConfig lee la configuración desde un archivo JSON.
+// Las referencias ${VAR} se sustituyen por variables de entorno.
+// Una ruta vacía retorna una configuración vacía.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(os.ExpandEnv(string(data))), config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// validate verifica la consistencia de la configuración
+func (c *Config) validate() error {
+	for name, alias := range c.Aliases {
+		if alias == nil || len(alias.Mirrors) == 0 {
+			return fmt.Errorf("alias %q: at least one base URL is required", name)
+		}
+		for _, base := range alias.Mirrors {
+			parsed, err := url.Parse(base)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("alias %q: base URL must be an absolute http(s) URL", name)
+			}
+		}
+	}
+
+	for name, preset := range c.Presets {
+		if !transformationRe.MatchString(preset) {
+			return fmt.Errorf("preset %q: invalid transformations %q", name, preset)
+		}
+	}
+
+	for name, widths := range c.Breakpoints {
+		if len(widths) == 0 {
+			return fmt.Errorf("breakpoints %q: at least one width is required", name)
+		}
+	}
+
+	for host, rule := range c.Hosts {
+		if rule == nil {
+			return fmt.Errorf("host %q: empty rule", host)
+		}
+		if rule.Auth != nil {
+			switch strings.ToLower(rule.Auth.Type) {
+			case "basic", "bearer":
+			default:
+				return fmt.Errorf("host %q: unsupported auth type %q", host, rule.Auth.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// RuleFor busca la regla de un host: coincidencia exacta, comodín (*.dominio.com) o "*"
+func (c *Config) RuleFor(host string) *HostRule {
+	if c == nil || len(c.Hosts) == 0 {
+		return nil
+	}
+
+	host = strings.ToLower(host)
+	if rule, ok := c.Hosts[host]; ok {
+		return rule
+	}
+
+	// Probar sin puerto
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+		if rule, ok := c.Hosts[host]; ok {
+			return rule
+		}
+	}
+
+	// Probar comodines desde el dominio más específico
+	for domain := host; strings.Contains(domain, "."); {
+		_, domain, _ = strings.Cut(domain, ".")
+		if rule, ok := c.Hosts["*."+domain]; ok {
+			return rule
+		}
+	}
+
+	return c.Hosts["*"]
+}
+
+// ShouldForwardOrigin indica si se deben enviar Referer/Origin al host
+func (r *HostRule) ShouldForwardOrigin() bool {
+	if r == nil || r.ForwardOrigin == nil {
+		return true
+	}
+	return *r.ForwardOrigin
+}
+
+// CheckOrigin verifica que el valor de origin esté permitido para el host de origen.
+// Sin lista configurada para el host ni por defecto, sólo se acepta el propio host de la
+// imagen; para aceptar cualquier origin hay que configurar explícitamente ["*"].
+func (c *Config) CheckOrigin(sourceHost, origin string) error {
+	if origin == "" {
+		return nil
+	}
+
+	var allowed []string
+	if rule := c.RuleFor(sourceHost); rule != nil && rule.AllowedOrigins != nil {
+		allowed = rule.AllowedOrigins
+	} else if c != nil {
+		allowed = c.DefaultAllowedOrigins
+	}
+	if allowed == nil {
+		allowed = []string{originHostname(sourceHost)}
+	}
+
+	originHost := originHostname(origin)
+	for _, pattern := range allowed {
+		if matchHostPattern(strings.ToLower(pattern), originHost) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrOriginNotAllowed, origin)
+}
+
+// originHostname extrae el hostname de un valor de origin ("dominio.com" o "https://dominio.com/ruta")
+func originHostname(origin string) string {
+	origin = strings.ToLower(strings.TrimSpace(origin))
+	if !strings.Contains(origin, "://") {
+		origin = "https://" + origin
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// matchHostPattern compara un hostname con un patrón exacto, comodín (*.dominio.com) o "*"
+func matchHostPattern(pattern, host string) bool {
+	if host == "" {
+		return false
+	}
+	if pattern == "*" || pattern == host {
+		return true
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package images
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestCheckOrigin verifica las listas de origin permitidos y el comportamiento sin configuración
+func TestCheckOrigin(t *testing.T) {
+	configured := &Config{
+		DefaultAllowedOrigins: []string{"mysite.com", "*.mysite.com"},
+		Hosts: map[string]*HostRule{
+			"cdn.partner.com": {AllowedOrigins: []string{"partner.com"}},
+			"closed.com":      {AllowedOrigins: []string{}},
+			"open.com":        {AllowedOrigins: []string{"*"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		config     *Config
+		sourceHost string
+		origin     string
+		allowed    bool
+	}{
+		{"no config rejects other sites", nil, "images.example.com", "evil.com", false},
+		{"no config accepts the image host", nil, "images.example.com", "https://images.example.com/page", true},
+		{"no config ignores the port", nil, "images.example.com:8080", "images.example.com", true},
+		{"empty config rejects other sites", &Config{}, "images.example.com", "evil.com", false},
+		{"no origin is always accepted", nil, "images.example.com", "", true},
+		{"default list exact", configured, "img.other.com", "mysite.com", true},
+		{"default list wildcard", configured, "img.other.com", "https://www.mysite.com", true},
+		{"default list rejects", configured, "img.other.com", "evil.com", false},
+		{"host list replaces the default", configured, "cdn.partner.com", "mysite.com", false},
+		{"host list accepts", configured, "cdn.partner.com", "partner.com", true},
+		{"empty host list rejects everything", configured, "closed.com", "closed.com", false},
+		{"explicit wildcard accepts everything", configured, "open.com", "anything.net", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.CheckOrigin(test.sourceHost, test.origin)
+			if test.allowed && err != nil {
+				t.Errorf("CheckOrigin(%q, %q) = %v, want nil", test.sourceHost, test.origin, err)
+			}
+			if !test.allowed && !errors.Is(err, ErrOriginNotAllowed) {
+				t.Errorf("CheckOrigin(%q, %q) = %v, want ErrOriginNotAllowed", test.sourceHost, test.origin, err)
+			}
+		})
+	}
+}
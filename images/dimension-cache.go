@@ -0,0 +1,71 @@
+package images
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCachedDimensions limita el número de originales cuyas dimensiones se recuerdan
+const maxCachedDimensions = 10000
+
+// dimensions son el ancho y alto de una imagen original
+type dimensions struct {
+	width, height int
+	expiresAt     time.Time
+}
+
+// dimensionCache recuerda las dimensiones de los originales usados por /api/srcset, para no
+// descargarlos completos en cada petición. Las entradas expiran con el TTL por defecto del caché.
+type dimensionCache struct {
+	mu      sync.Mutex
+	entries map[string]dimensions
+}
+
+// get retorna las dimensiones de un original si se conocen y no expiraron
+func (dc *dimensionCache) get(sourceURL string, now time.Time) (int, int, bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	entry, ok := dc.entries[sourceURL]
+	if !ok || !now.Before(entry.expiresAt) {
+		return 0, 0, false
+	}
+	return entry.width, entry.height, true
+}
+
+// put guarda las dimensiones de un original; al alcanzar maxCachedDimensions descarta las
+// expiradas y, si no alcanza, una cualquiera
+func (dc *dimensionCache) put(sourceURL string, width, height int, expiresAt time.Time) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if dc.entries == nil {
+		dc.entries = make(map[string]dimensions)
+	}
+	if _, exists := dc.entries[sourceURL]; !exists && len(dc.entries) >= maxCachedDimensions {
+		now := time.Now()
+		for candidate, entry := range dc.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(dc.entries, candidate)
+			}
+		}
+		for candidate := range dc.entries {
+			if len(dc.entries) < maxCachedDimensions {
+				break
+			}
+			delete(dc.entries, candidate)
+		}
+	}
+	dc.entries[sourceURL] = dimensions{width: width, height: height, expiresAt: expiresAt}
+}
+
+// removeWhere olvida las dimensiones de los originales cuya URL cumple la condición
+func (dc *dimensionCache) removeWhere(match func(sourceURL string) bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	for sourceURL := range dc.entries {
+		if match(sourceURL) {
+			delete(dc.entries, sourceURL)
+		}
+	}
+}
@@ -2,41 +2,124 @@ package images
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
+// ErrOriginUnavailable indica un fallo del origen (5xx, timeout o error de red) que permite probar otro mirror
+var ErrOriginUnavailable = errors.New("origin unavailable")
+
+// defaultDownloadTimeout es el timeout de descarga cuando el host no define uno
+const defaultDownloadTimeout = 30 * time.Second
+
 // ImageDownloader maneja la descarga de imágenes desde URLs
 type ImageDownloader struct {
-	client *http.Client
+	client      *http.Client
+	hostClients map[*HostRule]*http.Client // hosts con proxy/TLS propio
+	limiters    limiterRegistry            // hostname -> *hostLimiter
+	config      *Config
+}
+
+// FetchedImage contiene los bytes descargados y los headers de respuesta del origen
+type FetchedImage struct {
+	Data        []byte
+	Header      http.Header
+	ServedBy    string // URL que sirvió la imagen (relevante con mirrors)
+	NotModified bool   // el origen respondió 304 a una petición condicional; Data está vacío
 }
 
 // NewImageDownloader crea una nueva instancia del descargador
-func NewImageDownloader() *ImageDownloader {
-	return &ImageDownloader{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+func NewImageDownloader(config *Config) (*ImageDownloader, error) {
+	transport, err := NewTransport(config.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	hostClients := make(map[*HostRule]*http.Client)
+	for host, rule := range config.Hosts {
+		if rule.Transport == nil {
+			continue
+		}
+		hostTransport, err := NewTransport(config.Transport.merge(rule.Transport))
+		if err != nil {
+			return nil, fmt.Errorf("host %q: %v", host, err)
+		}
+		hostClients[rule] = &http.Client{Transport: hostTransport}
 	}
+
+	return &ImageDownloader{
+		// El timeout se aplica por petición según la regla del host
+		client:      &http.Client{Transport: transport},
+		hostClients: hostClients,
+		config:      config,
+	}, nil
 }
 
 // DownloadImage descarga una imagen desde la URL especificada
-func (id *ImageDownloader) DownloadImage(imageURL, origin string) ([]byte, error) {
-	req, err := http.NewRequest("GET", imageURL, nil)
+func (id *ImageDownloader) DownloadImage(imageURL, origin string) (*FetchedImage, error) {
+	return id.download(imageURL, origin, Validators{})
+}
+
+// download descarga una imagen; con validadores la petición es condicional
+func (id *ImageDownloader) download(imageURL, origin string, validators Validators) (*FetchedImage, error) {
+	parsedURL, err := url.Parse(imageURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	rule := id.config.RuleFor(parsedURL.Host)
+
+	timeout := defaultDownloadTimeout
+	if rule != nil && rule.Timeout.Duration > 0 {
+		timeout = rule.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	// Establecer headers para evitar bloqueos
-	id.setHeaders(req, origin)
+	id.setHeaders(req, origin, rule)
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
 
-	resp, err := id.client.Do(req)
+	client := id.client
+	if hostClient, ok := id.hostClients[rule]; ok {
+		client = hostClient
+	}
+
+	// Respetar el presupuesto de peticiones del host
+	limiter := id.limiterFor(parsedURL.Hostname(), rule)
+	if limiter != nil {
+		if err := limiter.waitRequest(ctx, parsedURL.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download image: %v", err)
+		return nil, fmt.Errorf("failed to download image: %v (%w)", err, ErrOriginUnavailable)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("failed to download image: status %d (%w)", resp.StatusCode, ErrOriginUnavailable)
+	}
+	if resp.StatusCode == http.StatusNotModified && (validators != Validators{}) {
+		return &FetchedImage{Header: resp.Header, ServedBy: imageURL, NotModified: true}, nil
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to download image: status %d", resp.StatusCode)
 	}
@@ -48,23 +131,50 @@ func (id *ImageDownloader) DownloadImage(imageURL, origin string) ([]byte, error
 		return nil, err
 	}
 
-	// Leer el contenido
+	// Leer el contenido respetando el ancho de banda del host
+	var body io.Reader = resp.Body
+	if limiter != nil {
+		body = limiter.throttleReader(ctx, body)
+	}
 	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(resp.Body)
+	_, err = buf.ReadFrom(body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read image data: %v", err)
+		return nil, fmt.Errorf("failed to read image data: %v (%w)", err, ErrOriginUnavailable)
+	}
+
+	return &FetchedImage{
+		Data:     buf.Bytes(),
+		Header:   resp.Header,
+		ServedBy: imageURL,
+	}, nil
+}
+
+// limiterFor retorna el limitador del host, creándolo si su regla define rate_limit.
+// Cada hostname tiene su propio presupuesto aunque comparta regla con otros.
+func (id *ImageDownloader) limiterFor(hostname string, rule *HostRule) *hostLimiter {
+	if rule == nil || rule.RateLimit == nil {
+		return nil
 	}
+	return id.limiters.get(hostname, rule.RateLimit, time.Now())
+}
 
-	return buf.Bytes(), nil
+// Fetch implementa Source descargando la imagen por HTTP
+func (id *ImageDownloader) Fetch(imageRef, origin string) (*FetchedImage, error) {
+	return id.DownloadImage(imageRef, origin)
+}
+
+// FetchIfModified implementa ConditionalSource con If-None-Match e If-Modified-Since
+func (id *ImageDownloader) FetchIfModified(imageRef, origin string, validators Validators) (*FetchedImage, error) {
+	return id.download(imageRef, origin, validators)
 }
 
 // setHeaders configura los headers necesarios para la petición
-func (id *ImageDownloader) setHeaders(req *http.Request, origin string) {
+func (id *ImageDownloader) setHeaders(req *http.Request, origin string, rule *HostRule) {
 	// User-Agent para evitar bloqueos
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
 	
-	// Headers de origen si se especifica
-	if origin != "" {
+	// Headers de origen si se especifica y el host lo permite
+	if origin != "" && rule.ShouldForwardOrigin() {
 		req.Header.Set("Referer", origin)
 		req.Header.Set("Origin", origin)
 	}
@@ -73,4 +183,23 @@ func (id *ImageDownloader) setHeaders(req *http.Request, origin string) {
 	req.Header.Set("Accept", "image/webp,image/apng,image/*,*/*;q=0.8")
 	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
 	req.Header.Set("Cache-Control", "no-cache")
+
+	if rule == nil {
+		return
+	}
+
+	// Headers personalizados del host (pueden sobrescribir los anteriores)
+	for name, value := range rule.Headers {
+		req.Header.Set(name, value)
+	}
+
+	// Credenciales para orígenes privados
+	if rule.Auth != nil {
+		switch strings.ToLower(rule.Auth.Type) {
+		case "basic":
+			req.SetBasicAuth(rule.Auth.Username, rule.Auth.Password)
+		case "bearer":
+			req.Header.Set("Authorization", "Bearer "+rule.Auth.Token)
+		}
+	}
 }
\ No newline at end of file
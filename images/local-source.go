@@ -0,0 +1,91 @@
+package images
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// LocalPrefix identifica las imágenes servidas desde el directorio local
+const LocalPrefix = "local:"
+
+// LocalSource lee imágenes originales desde un directorio local
+type LocalSource struct {
+	root *os.Root
+}
+
+// NewLocalSource crea una fuente local restringida al directorio indicado
+func NewLocalSource(dir string) (*LocalSource, error) {
+	// os.Root impide salir del directorio, incluso mediante enlaces simbólicos
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local source directory: %v", err)
+	}
+	return &LocalSource{root: root}, nil
+}
+
+// ReadImage lee una imagen a partir de una referencia "local:/ruta/imagen.jpg"
+func (ls *LocalSource) ReadImage(imageRef string) (*FetchedImage, error) {
+	imagePath, err := cleanLocalPath(strings.TrimPrefix(imageRef, LocalPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := ls.root.Open(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local image: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local image: %v", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("local path is a directory: %s", imagePath)
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image data: %v", err)
+	}
+
+	// Verificar que el contenido sea una imagen
+	contentType := http.DetectContentType(data)
+	processor := NewImageProcessor()
+	if err := processor.ValidateImageURL(contentType); err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+
+	return &FetchedImage{
+		Data:   data,
+		Header: header,
+	}, nil
+}
+
+// Fetch implementa Source leyendo la imagen desde el directorio local
+func (ls *LocalSource) Fetch(imageRef, origin string) (*FetchedImage, error) {
+	return ls.ReadImage(imageRef)
+}
+
+// cleanLocalPath normaliza una ruta local y rechaza intentos de path traversal
+func cleanLocalPath(rawPath string) (string, error) {
+	for _, segment := range strings.Split(rawPath, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("invalid local image path: %s", rawPath)
+		}
+	}
+
+	cleaned := strings.TrimPrefix(path.Clean("/"+rawPath), "/")
+	if cleaned == "" {
+		return "", fmt.Errorf("invalid local image path: %s", rawPath)
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,89 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPNG retorna una imagen PNG pequeña válida
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestCleanLocalPath verifica que las rutas locales se normalicen y que ".." se rechace
+func TestCleanLocalPath(t *testing.T) {
+	valid := map[string]string{
+		"/products/a.jpg":    "products/a.jpg",
+		"products//a.jpg":    "products/a.jpg",
+		"/products/./a.jpg":  "products/a.jpg",
+		"/products/a..b.jpg": "products/a..b.jpg",
+	}
+	for rawPath, want := range valid {
+		if got, err := cleanLocalPath(rawPath); err != nil || got != want {
+			t.Errorf("cleanLocalPath(%q) = %q, %v; want %q", rawPath, got, err, want)
+		}
+	}
+
+	for _, rawPath := range []string{"", "/", "../etc/passwd", "/products/../../etc/passwd", "products/.."} {
+		if got, err := cleanLocalPath(rawPath); err == nil {
+			t.Errorf("cleanLocalPath(%q) = %q, want an error", rawPath, got)
+		}
+	}
+}
+
+// TestLocalSourceStaysInRoot verifica que los enlaces simbólicos no permitan leer fuera del directorio
+func TestLocalSourceStaysInRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "originals")
+	if err := os.MkdirAll(filepath.Join(root, "products"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := testPNG(t)
+	if err := os.WriteFile(filepath.Join(root, "products", "a.png"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(dir, "secret.png")
+	if err := os.WriteFile(outside, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "products", "link.png")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(dir, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := NewLocalSource(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched, err := source.ReadImage("local:/products/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched.Data) != len(data) || fetched.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("read %d bytes as %s", len(fetched.Data), fetched.Header.Get("Content-Type"))
+	}
+
+	for _, ref := range []string{
+		"local:/products/link.png",
+		"local:/escape/secret.png",
+		"local:/../secret.png",
+		"local:/products",
+		"local:/products/missing.png",
+	} {
+		if _, err := source.ReadImage(ref); err == nil {
+			t.Errorf("ReadImage(%q) succeeded, want an error", ref)
+		}
+	}
+}
@@ -1,77 +1,413 @@
 package images
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/loxzer01/serve-img-optimized/cache"
+	"github.com/loxzer01/serve-img-optimized/peers"
 )
 
 // ImageOptimizer coordina todo el proceso de optimización de imágenes
 type ImageOptimizer struct {
 	cacheManager *cache.CacheManager
-	downloader   *ImageDownloader
+	source       Source
 	processor    *ImageProcessor
 	paramsParser *ParamsParser
+	config       *Config
+	refreshing   sync.Map         // claves de caché con una revalidación en curso
+	inflight     sync.Map         // claves de caché con una generación en curso -> *flight
+	dimensions   dimensionCache   // dimensiones de los originales usados por /api/srcset
+	Peers        *peers.PeerGroup // réplicas que se reparten las variantes; nil = deshabilitado
 }
 
 // NewImageOptimizer crea una nueva instancia del optimizador
-func NewImageOptimizer(cacheManager *cache.CacheManager) *ImageOptimizer {
+func NewImageOptimizer(cacheManager *cache.CacheManager, config *Config, source Source) *ImageOptimizer {
 	return &ImageOptimizer{
 		cacheManager: cacheManager,
-		downloader:   NewImageDownloader(),
+		source:       source,
 		processor:    NewImageProcessor(),
-		paramsParser: NewParamsParser(),
+		paramsParser: NewParamsParser(config),
+		config:       config,
 	}
 }
 
-// OptimizeImage procesa una imagen según los parámetros especificados
-func (io *ImageOptimizer) OptimizeImage(r *http.Request) ([]byte, string, error) {
+// OptimizeImage procesa una imagen según los parámetros especificados.
+// Retorna la imagen y sus metadatos (content type, dimensiones, ETag).
+func (io *ImageOptimizer) OptimizeImage(r *http.Request) ([]byte, *cache.EntryMeta, error) {
 	// 1. Parsear parámetros
 	params, err := io.paramsParser.ParseURLParams(r)
 	if err != nil {
-		return nil, "", fmt.Errorf("parameter parsing error: %v", err)
+		return nil, nil, fmt.Errorf("parameter parsing error: %w", err)
+	}
+
+	// Verificar que el origin solicitado esté permitido para el host
+	if err := io.checkOrigin(params); err != nil {
+		return nil, nil, err
 	}
 
 	// 2. Generar clave de caché
-	cacheKey := io.cacheManager.GenerateCacheKey(params.URL, params.Width, params.Quality)
+	cacheKey := io.cacheManager.GenerateCacheKey(params.CacheKey(), params.Format)
 
 	// 3. Verificar caché
-	if cachedData, found := io.cacheManager.GetCachedImage(cacheKey); found {
-		return cachedData, "image/jpeg", nil
+	entry, found := io.cacheManager.GetCachedImage(cacheKey)
+	if found {
+		io.tagEntry(cacheKey, entry, params.Tags)
+		switch entry.State {
+		case cache.EntryFresh:
+			return entry.Data, entry.Meta, nil
+		case cache.EntryStale:
+			// Servir contenido expirado y refrescar en segundo plano
+			io.revalidate(r, params, cacheKey, entry)
+			return entry.Data, entry.Meta, nil
+		}
+	}
+
+	// Las peticiones concurrentes de la misma variante esperan a una única generación
+	processedData, meta, shared, err := io.singleflight(cacheKey, func() ([]byte, *cache.EntryMeta, error) {
+		// Pedir la variante a la réplica dueña de la clave, si es otra
+		if data, meta, ok := io.fetchFromOwner(r, cacheKey); ok {
+			return data, meta, nil
+		}
+
+		// 4-6. Descargar, procesar y guardar en caché
+		return io.fetchAndStore(params, cacheKey)
+	})
+	if err == nil && shared && len(params.Tags) > 0 {
+		// La generación compartida guardó las etiquetas de otra petición
+		if entry, found := io.cacheManager.GetCachedImage(cacheKey); found {
+			io.tagEntry(cacheKey, entry, params.Tags)
+		}
+	}
+	if err != nil {
+		if found {
+			// stale-if-error: el origen falló pero aún podemos servir la entrada expirada
+			fmt.Printf("Warning: serving stale image for %s: %v\n", params.URL, err)
+			return entry.Data, entry.Meta, nil
+		}
+		return nil, nil, err
+	}
+
+	return processedData, meta, nil
+}
+
+// flight es una generación de variante en curso, compartida por las peticiones concurrentes
+type flight struct {
+	done    chan struct{}
+	waiters atomic.Int32 // llamadas que esperan el resultado
+	data    []byte
+	meta    *cache.EntryMeta
+	err     error
+}
+
+// singleflight ejecuta fn una sola vez por clave a la vez: las llamadas que llegan mientras
+// otra está en curso esperan y reciben su resultado, con shared en true
+func (io *ImageOptimizer) singleflight(cacheKey string, fn func() ([]byte, *cache.EntryMeta, error)) ([]byte, *cache.EntryMeta, bool, error) {
+	call := &flight{done: make(chan struct{})}
+	if running, loaded := io.inflight.LoadOrStore(cacheKey, call); loaded {
+		call = running.(*flight)
+		call.waiters.Add(1)
+		<-call.done
+		return call.data, call.meta, true, call.err
+	}
+
+	defer func() {
+		io.inflight.Delete(cacheKey)
+		close(call.done)
+	}()
+	call.data, call.meta, call.err = fn()
+	return call.data, call.meta, false, call.err
+}
+
+// checkOrigin valida el parámetro origin contra la configuración del host de origen
+func (io *ImageOptimizer) checkOrigin(params *ImageParams) error {
+	if params.Origin == "" || sourcePrefix(params.URL) != "" {
+		return nil
+	}
+	for _, candidate := range append([]string{params.URL}, params.Mirrors...) {
+		parsedURL, err := url.Parse(candidate)
+		if err != nil {
+			return fmt.Errorf("invalid image URL: %v", err)
+		}
+		if err := io.config.CheckOrigin(parsedURL.Host, params.Origin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchFromOwner obtiene la variante de la réplica dueña de la clave y la guarda en el caché
+// local por el tiempo de vida que le queda. Retorna false si no hay grupo de réplicas, si esta
+// réplica es la dueña, si la petición ya fue reenviada por otra réplica o si el dueño falla.
+func (io *ImageOptimizer) fetchFromOwner(r *http.Request, cacheKey string) ([]byte, *cache.EntryMeta, bool) {
+	if io.Peers == nil || peers.IsPeerRequest(r) {
+		return nil, nil, false
+	}
+	owner, isSelf := io.Peers.Owner(cacheKey)
+	if isSelf {
+		return nil, nil, false
 	}
 
+	data, meta, err := io.Peers.Fetch(owner, r.URL.RequestURI(), r.Header)
+	if err != nil {
+		fmt.Printf("Warning: failed to fetch %s from peer %s, processing locally: %v\n", cacheKey, owner, err)
+		return nil, nil, false
+	}
+
+	if ttl := time.Until(meta.ExpiresAt); ttl > 0 {
+		if err := io.cacheManager.SaveImageToCache(cacheKey, data, ttl, meta); err != nil {
+			fmt.Printf("Warning: Failed to save to cache: %v\n", err)
+		}
+	} else {
+		meta.Fill(data)
+	}
+	return data, meta, true
+}
+
+// fetchAndStore descarga y procesa la imagen, guardando el resultado en caché
+func (io *ImageOptimizer) fetchAndStore(params *ImageParams, cacheKey string) ([]byte, *cache.EntryMeta, error) {
 	// 4. Descargar imagen
-	imageData, err := io.downloader.DownloadImage(params.URL, params.Origin)
+	fetched, err := io.fetchOriginal(params)
 	if err != nil {
-		return nil, "", fmt.Errorf("download error: %v", err)
+		return nil, nil, fmt.Errorf("download error: %w", err)
 	}
+	return io.processAndStore(params, cacheKey, fetched)
+}
 
+// processAndStore procesa un original descargado y guarda la variante en caché
+func (io *ImageOptimizer) processAndStore(params *ImageParams, cacheKey string, fetched *FetchedImage) ([]byte, *cache.EntryMeta, error) {
 	// 5. Procesar imagen
-	processedData, err := io.processor.ProcessImage(imageData, params.Width, params.Quality)
+	img, err := io.processor.DecodeImage(fetched.Data)
 	if err != nil {
-		return nil, "", fmt.Errorf("processing error: %v", err)
+		return nil, nil, fmt.Errorf("processing error: %v", err)
+	}
+	processedData, size, err := io.processor.EncodeVariant(img, params.Width, params.Quality, params.Format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("processing error: %v", err)
+	}
+
+	// 6. Guardar en caché con el TTL indicado por el origen
+	meta := variantMeta(params, fetched, size)
+	io.saveVariant(cacheKey, processedData, fetched.Header, meta)
+
+	return processedData, meta, nil
+}
+
+// variantMeta construye los metadatos de una variante generada a partir de un original
+func variantMeta(params *ImageParams, fetched *FetchedImage, size image.Point) *cache.EntryMeta {
+	return &cache.EntryMeta{
+		ContentType:        params.ContentType(),
+		Width:              size.X,
+		Height:             size.Y,
+		SourceURL:          params.URL,
+		ServedBy:           fetched.ServedBy,
+		OriginETag:         fetched.Header.Get("ETag"),
+		OriginLastModified: fetched.Header.Get("Last-Modified"),
+		OriginalSize:       int64(len(fetched.Data)),
+		Tags:               variantTags(params, fetched.Header),
+	}
+}
+
+// tagEntry agrega a una entrada encontrada en caché las etiquetas solicitadas que aún no tiene,
+// de modo que una petición con ?tags= también etiqueta variantes generadas antes
+func (io *ImageOptimizer) tagEntry(cacheKey string, entry *cache.CacheEntry, requested []string) {
+	tags := entry.Meta.Tags
+	for _, tag := range requested {
+		if len(tags) == maxTags {
+			break
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(slices.Clip(tags), tag)
+		}
+	}
+	if len(tags) == len(entry.Meta.Tags) {
+		return
+	}
+
+	meta, err := io.cacheManager.SetTags(cacheKey, entry, tags)
+	if err != nil {
+		fmt.Printf("Warning: failed to tag cache entry %s: %v\n", cacheKey, err)
 	}
+	entry.Meta = meta
+}
+
+// variantTags reúne las etiquetas de una variante: las solicitadas, la del alias de origen
+// ("@alias") y las del header Surrogate-Key del origen
+func variantTags(params *ImageParams, originHeader http.Header) []string {
+	values := append([]string{}, params.Tags...)
+	if params.Alias != "" {
+		values = append(values, "@"+params.Alias)
+	}
+	values = append(values, strings.Fields(originHeader.Get("Surrogate-Key"))...)
+
+	// Las claves del origen que no sean válidas se descartan en lugar de fallar la petición
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range values {
+		if seen[tag] || !tagRe.MatchString(tag) || len(tags) == maxTags {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
 
-	// 6. Guardar en caché
-	if err := io.cacheManager.SaveImageToCache(cacheKey, processedData); err != nil {
+// saveVariant guarda una variante procesada con el TTL derivado de los headers del origen.
+// Los metadatos se completan aunque la variante no sea cacheable, marcándola con NoStore
+// para que la respuesta tampoco se almacene en cachés compartidas.
+func (io *ImageOptimizer) saveVariant(cacheKey string, data []byte, originHeader http.Header, meta *cache.EntryMeta) {
+	ttl, cacheable := io.cacheManager.TTLPolicy.TTLFromHeaders(originHeader, time.Now())
+	if !cacheable {
+		meta.CreatedAt = time.Now()
+		meta.NoStore = true
+		meta.Fill(data)
+		return
+	}
+	if err := io.cacheManager.SaveImageToCache(cacheKey, data, ttl, meta); err != nil {
 		// Log error pero no fallar la respuesta
 		fmt.Printf("Warning: Failed to save to cache: %v\n", err)
 	}
+}
+
+// fetchOriginal obtiene la imagen original, probando los mirrors en orden
+// cuando el origen principal no está disponible (5xx, timeout o error de red)
+func (io *ImageOptimizer) fetchOriginal(params *ImageParams) (*FetchedImage, error) {
+	candidates := append([]string{params.URL}, params.Mirrors...)
+
+	var lastErr error
+	for i, candidate := range candidates {
+		fetched, err := io.source.Fetch(candidate, params.Origin)
+		if err == nil {
+			if i > 0 {
+				fmt.Printf("Origin failover: %s served by mirror %s\n", params.URL, candidate)
+			}
+			if fetched.ServedBy == "" {
+				fetched.ServedBy = candidate
+			}
+			return fetched, nil
+		}
+		if !errors.Is(err, ErrOriginUnavailable) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// revalidate refresca una entrada en segundo plano, evitando revalidaciones duplicadas
+func (io *ImageOptimizer) revalidate(r *http.Request, params *ImageParams, cacheKey string, entry *cache.CacheEntry) {
+	if _, running := io.refreshing.LoadOrStore(cacheKey, struct{}{}); running {
+		return
+	}
+
+	// La petición original termina antes que la revalidación
+	r = r.Clone(context.Background())
+
+	// La nueva versión conserva las etiquetas que ya tenía la entrada
+	revalidated := *params
+	revalidated.Tags = entry.Meta.Tags
+	params = &revalidated
+	go func() {
+		defer io.refreshing.Delete(cacheKey)
+		if _, _, ok := io.fetchFromOwner(r, cacheKey); ok {
+			return
+		}
+		if io.revalidateConditional(params, cacheKey, entry) {
+			return
+		}
+		if _, _, err := io.fetchAndStore(params, cacheKey); err != nil {
+			fmt.Printf("Warning: background revalidation failed for %s: %v\n", params.URL, err)
+		}
+	}()
+}
+
+// revalidateConditional revalida una entrada con una petición condicional a la URL que sirvió
+// el original. Si no cambió (304) se renueva el TTL sin descargar ni procesar la imagen.
+// Retorna false si la entrada no guarda validadores o la petición falla, para descargarla completa.
+func (io *ImageOptimizer) revalidateConditional(params *ImageParams, cacheKey string, entry *cache.CacheEntry) bool {
+	source, ok := io.source.(ConditionalSource)
+	if !ok || (entry.Meta.OriginETag == "" && entry.Meta.OriginLastModified == "") {
+		return false
+	}
+	ref := entry.Meta.ServedBy
+	if ref == "" {
+		ref = params.URL
+	}
+
+	fetched, err := source.FetchIfModified(ref, params.Origin, Validators{
+		ETag:         entry.Meta.OriginETag,
+		LastModified: entry.Meta.OriginLastModified,
+	})
+	if err != nil {
+		return false
+	}
+	if !fetched.NotModified {
+		// El original cambió: procesar la nueva versión ya descargada
+		if _, _, err := io.processAndStore(params, cacheKey, fetched); err != nil {
+			fmt.Printf("Warning: background revalidation failed for %s: %v\n", params.URL, err)
+		}
+		return true
+	}
+
+	ttl, cacheable := io.cacheManager.TTLPolicy.TTLFromHeaders(fetched.Header, time.Now())
+	if !cacheable {
+		return false
+	}
+	// El 304 puede traer validadores actualizados
+	meta := *entry.Meta
+	if etag := fetched.Header.Get("ETag"); etag != "" {
+		meta.OriginETag = etag
+	}
+	if lastModified := fetched.Header.Get("Last-Modified"); lastModified != "" {
+		meta.OriginLastModified = lastModified
+	}
+	if err := io.cacheManager.SaveImageToCache(cacheKey, entry.Data, ttl, &meta); err != nil {
+		fmt.Printf("Warning: Failed to save to cache: %v\n", err)
+	}
+	return true
+}
+
+// OptimizeUpload procesa una imagen recibida directamente, sin URL de origen ni caché
+func (io *ImageOptimizer) OptimizeUpload(imageData []byte, transformations string) ([]byte, string, error) {
+	params, err := io.paramsParser.ParseTransformations(transformations)
+	if err != nil {
+		return nil, "", fmt.Errorf("parameter parsing error: %w", err)
+	}
+
+	// Verificar que el contenido sea una imagen
+	contentType := http.DetectContentType(imageData)
+	if err := io.processor.ValidateImageURL(contentType); err != nil {
+		return nil, "", fmt.Errorf("%w: uploaded data is not an image: %s", ErrInvalidParams, contentType)
+	}
 
-	return processedData, "image/jpeg", nil
+	processedData, err := io.processor.ProcessImage(imageData, params.Width, params.Quality, params.Format)
+	if err != nil {
+		return nil, "", fmt.Errorf("processing error: %v", err)
+	}
+
+	return processedData, params.ContentType(), nil
 }
 
 // GetImageInfo obtiene información de una imagen sin procesarla
 func (io *ImageOptimizer) GetImageInfo(imageURL string) (map[string]interface{}, error) {
 	// Descargar imagen
-	imageData, err := io.downloader.DownloadImage(imageURL, "")
+	fetched, err := io.source.Fetch(imageURL, "")
 	if err != nil {
-		return nil, fmt.Errorf("download error: %v", err)
+		return nil, fmt.Errorf("download error: %w", err)
 	}
 
 	// Obtener información
-	return io.processor.GetImageInfo(imageData)
+	return io.processor.GetImageInfo(fetched.Data)
 }
 
 // ValidateImageURL valida si una URL contiene una imagen válida
@@ -79,12 +415,34 @@ func (io *ImageOptimizer) ValidateImageURL(imageURL string) error {
 	return io.processor.ValidateImageURL(imageURL)
 }
 
+// CacheControl retorna el header Cache-Control con el que se sirve una variante
+func (io *ImageOptimizer) CacheControl(meta *cache.EntryMeta) string {
+	return io.cacheManager.CacheControl(meta, time.Now())
+}
+
 // GetCacheStats obtiene estadísticas del caché
 func (io *ImageOptimizer) GetCacheStats() map[string]interface{} {
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"cache_size": io.cacheManager.GetCacheSize(),
 		"cache_dir":  io.cacheManager.GetCacheDir(),
 	}
+	if entries, err := io.cacheManager.GetStats(); err == nil {
+		stats["scope"] = entries.Scope
+		stats["policy"] = entries.Policy
+		stats["hits"] = entries.Hits
+		stats["entries"] = entries.Entries
+		stats["bytes"] = entries.Bytes
+		stats["original_bytes"] = entries.OriginalBytes
+		stats["expired"] = entries.Expired
+		stats["content_types"] = entries.ContentTypes
+		if entries.Memory != nil {
+			stats["memory"] = entries.Memory
+		}
+	}
+	if io.Peers != nil {
+		stats["peers"] = io.Peers.Stats()
+	}
+	return stats
 }
 
 // CleanupCache limpia archivos antiguos del caché
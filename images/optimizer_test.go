@@ -0,0 +1,155 @@
+package images
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loxzer01/serve-img-optimized/cache"
+)
+
+// TestRevalidateConditional verifica que un 304 del origen renueve la entrada sin volver a descargarla
+func TestRevalidateConditional(t *testing.T) {
+	data := testPNG(t)
+	var downloads, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=600")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 12 Oct 2026 10:00:00 GMT")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	config := &Config{}
+	downloader, err := NewImageDownloader(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheManager := cache.NewCacheManager(t.TempDir(), time.Hour, 10)
+	optimizer := NewImageOptimizer(cacheManager, config, NewSourceRouter(downloader))
+
+	params, err := optimizer.paramsParser.ParsePath("w_2,f_png/"+server.URL+"/a.png", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheKey := cacheManager.GenerateCacheKey(params.CacheKey(), params.Format)
+	if _, _, err := optimizer.fetchAndStore(params, cacheKey); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, found := cacheManager.GetCachedImage(cacheKey)
+	if !found {
+		t.Fatal("variant was not cached")
+	}
+	if entry.Meta.OriginETag != `"v1"` || entry.Meta.OriginLastModified == "" {
+		t.Fatalf("origin validators not stored: %+v", entry.Meta)
+	}
+
+	// Simular una entrada expirada
+	stale := *entry.Meta
+	stale.ExpiresAt = time.Now().Add(-time.Second)
+	entry.Meta = &stale
+
+	if !optimizer.revalidateConditional(params, cacheKey, entry) {
+		t.Fatal("conditional revalidation was not used")
+	}
+	if downloads != 1 || notModified != 1 {
+		t.Errorf("downloads = %d, not modified = %d, want 1 and 1", downloads, notModified)
+	}
+
+	renewed, found := cacheManager.GetCachedImage(cacheKey)
+	if !found || renewed.State != cache.EntryFresh {
+		t.Fatal("entry was not renewed")
+	}
+	if renewed.Meta.ETag != entry.Meta.ETag || renewed.Meta.OriginETag != `"v1"` {
+		t.Errorf("renewed meta = %+v, want the original ETags", renewed.Meta)
+	}
+}
+
+// TestTagEntryOnHit verifica que las etiquetas de una petición se agreguen a una variante ya cacheada
+func TestTagEntryOnHit(t *testing.T) {
+	dir := t.TempDir()
+	cacheManager := cache.NewCacheManager(dir, time.Hour, 10)
+	optimizer := NewImageOptimizer(cacheManager, &Config{}, nil)
+
+	cacheKey := cacheManager.GenerateCacheKey("v2?src=a", "jpeg")
+	if err := cacheManager.SaveToCache(cacheKey, []byte("data"), time.Hour, &cache.EntryMeta{Tags: []string{"product-1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, _ := cacheManager.GetCachedImage(cacheKey)
+	optimizer.tagEntry(cacheKey, entry, []string{"product-1", "tenant-acme"})
+	if len(entry.Meta.Tags) != 2 {
+		t.Errorf("tags = %v, want [product-1 tenant-acme]", entry.Meta.Tags)
+	}
+
+	// Las etiquetas se guardan en los metadatos y se indexan
+	restarted := cache.NewCacheManager(dir, time.Hour, 10)
+	if purged := restarted.PurgeTags([]string{"tenant-acme"}); purged != 1 {
+		t.Errorf("purged %d entries by the new tag, want 1", purged)
+	}
+}
+
+// TestSingleflight verifica que las peticiones concurrentes de una variante compartan una sola generación
+func TestSingleflight(t *testing.T) {
+	optimizer := NewImageOptimizer(cache.NewCacheManager(t.TempDir(), time.Hour, 10), &Config{}, nil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	generate := func() ([]byte, *cache.EntryMeta, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return []byte("variant"), &cache.EntryMeta{ETag: `"v1"`}, nil
+	}
+
+	var wg sync.WaitGroup
+	var sharedCount atomic.Int32
+	run := func() {
+		defer wg.Done()
+		data, meta, shared, err := optimizer.singleflight("key", generate)
+		if err != nil || string(data) != "variant" || meta.ETag != `"v1"` {
+			t.Errorf("singleflight = %q, %+v, %v", data, meta, err)
+		}
+		if shared {
+			sharedCount.Add(1)
+		}
+	}
+
+	wg.Add(1)
+	go run()
+	<-started
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go run()
+	}
+	// Mantener abierta la generación hasta que las demás llamadas la estén esperando
+	running, _ := optimizer.inflight.Load("key")
+	for running.(*flight).waiters.Load() < 4 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 || sharedCount.Load() != 4 {
+		t.Errorf("calls = %d, shared = %d, want 1 and 4", calls.Load(), sharedCount.Load())
+	}
+
+	// Terminada la generación, la siguiente llamada vuelve a ejecutarse
+	if _, _, shared, _ := optimizer.singleflight("key", generate); shared || calls.Load() != 2 {
+		t.Errorf("shared = %v, calls = %d after the flight ended", shared, calls.Load())
+	}
+}
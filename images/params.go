@@ -1,9 +1,11 @@
 package images
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -17,73 +19,213 @@ type ImageParams struct {
 	Quality int
 	Width   int
 	Origin  string
+	Format  string   // formato de salida: jpeg, png o gif
+	Alias   string   // alias de origen usado en la petición, si existe
+	Mirrors []string // URLs alternativas del alias, en orden de preferencia
+	Ref     string   // referencia de la imagen tal como se solicitó (URL, @alias/ruta, local:/ruta)
+	Tags    []string // etiquetas para invalidar el caché en grupo; no forman parte de la clave
 }
 
+// TransformString retorna las transformaciones en forma canónica ("w_400,q_90,f_jpeg")
+func (p *ImageParams) TransformString() string {
+	return fmt.Sprintf("w_%d,q_%d,f_%s", p.Width, p.Quality, p.Format)
+}
+
+// cacheKeyVersion identifica el esquema de claves de caché. Se incrementa cuando
+// cambia el pipeline de procesamiento para que las entradas anteriores no se reutilicen.
+const cacheKeyVersion = 2
+
+// CacheKey retorna la serialización canónica de los parámetros que determinan el
+// resultado: origen resuelto, origin enviado al host y transformaciones con los
+// valores por defecto ya aplicados. Las claves se ordenan alfabéticamente.
+// El alias y los mirrors no forman parte de la clave porque sirven la misma imagen,
+// y la calidad solo se incluye en los formatos con pérdida (PNG y GIF la ignoran).
+// Cualquier nuevo parámetro o dato de negociación que altere la salida debe agregarse aquí.
+func (p *ImageParams) CacheKey() string {
+	values := url.Values{}
+	values.Set("src", p.URL)
+	values.Set("origin", p.Origin)
+	values.Set("w", strconv.Itoa(p.Width))
+	if p.Format == "jpeg" {
+		values.Set("q", strconv.Itoa(p.Quality))
+	}
+	values.Set("f", p.Format)
+	return fmt.Sprintf("v%d?%s", cacheKeyVersion, values.Encode())
+}
+
+// ContentType retorna el content type del formato de salida
+func (p *ImageParams) ContentType() string {
+	return ContentTypeFor(p.Format)
+}
+
+// ErrInvalidParams indica parámetros de transformación inválidos
+var ErrInvalidParams = errors.New("invalid parameters")
+
+// tagRe valida una etiqueta de caché
+var tagRe = regexp.MustCompile(`^[A-Za-z0-9_.:@/-]{1,128}$`)
+
+// maxTags limita las etiquetas que se pueden asociar a una entrada
+const maxTags = 20
+
+// transformationRe reconoce un segmento de transformaciones como "w_400,q_90"
+var transformationRe = regexp.MustCompile(`^[a-z]+_[a-z0-9]+(,[a-z]+_[a-z0-9]+)*$`)
+
 // ParamsParser maneja el parsing de parámetros de URL
-type ParamsParser struct{}
+type ParamsParser struct {
+	config *Config
+}
 
 // NewParamsParser crea una nueva instancia del parser
-func NewParamsParser() *ParamsParser {
-	return &ParamsParser{}
+func NewParamsParser(config *Config) *ParamsParser {
+	return &ParamsParser{config: config}
 }
 
 // ParseURLParams extrae los parámetros de la URL
-// Formato esperado: /w_400,q_90/url?origin="dominio.com"
+// Formato esperado: /w_400,q_90/url?origin="dominio.com" o /w_400,q_90/@alias/ruta
 func (pp *ParamsParser) ParseURLParams(r *http.Request) (*ImageParams, error) {
-	// Obtener el path completo
-	fullPath := chi.URLParam(r, "*")
+	params, err := pp.ParsePath(chi.URLParam(r, "*"), r.URL.Query().Get("origin"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Etiquetas para invalidación en grupo (?tags=product-42,tenant-acme)
+	if params.Tags, err = ParseTags(strings.Split(r.URL.Query().Get("tags"), ",")); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// ParsePath parsea la ruta de una variante ("w_400,q_90/url") y su origin
+func (pp *ParamsParser) ParsePath(fullPath, origin string) (*ImageParams, error) {
 	if fullPath == "" {
 		return nil, fmt.Errorf("no path provided")
 	}
 
-	// Regex mejorada para parsear el formato /w_400,q_90/url
-	re := regexp.MustCompile(`^/?(?:w_(\d+))?(?:,q_(\d+))?/?(.+)$`)
-	matches := re.FindStringSubmatch(fullPath)
-	
-	if len(matches) < 4 {
+	// Separar las transformaciones (w_400,q_90) de la referencia de la imagen
+	transformations, imageRef := "", strings.TrimPrefix(fullPath, "/")
+	if segment, rest, found := strings.Cut(imageRef, "/"); found && transformationRe.MatchString(segment) {
+		transformations, imageRef = segment, rest
+	}
+	if imageRef == "" {
 		return nil, fmt.Errorf("invalid URL format. Expected: /w_400,q_90/url or /w_400/url or /q_90/url")
 	}
 
-	params := &ImageParams{
-		Width:   400, // default
-		Quality: 90, // default
+	params, err := pp.ParseTransformations(transformations)
+	if err != nil {
+		return nil, err
 	}
 
-	// Parsear width
-	if matches[1] != "" {
-		if w, err := strconv.Atoi(matches[1]); err == nil {
-			if err := pp.validateWidth(w); err != nil {
-				return nil, err
-			}
-			params.Width = w
-		}
+	// Parsear y validar URL (directa o mediante alias) y origin
+	if err := pp.ParseSource(params, imageRef, origin); err != nil {
+		return nil, err
 	}
 
-	// Parsear quality
-	if matches[2] != "" {
-		if q, err := strconv.Atoi(matches[2]); err == nil {
-			if err := pp.validateQuality(q); err != nil {
-				return nil, err
-			}
-			params.Quality = q
+	return params, nil
+}
+
+// ParseSource resuelve la referencia de la imagen (URL, @alias/ruta o fuente con prefijo)
+// y el origin, completando los parámetros indicados
+func (pp *ParamsParser) ParseSource(params *ImageParams, imageRef, origin string) error {
+	var imageURL string
+	var err error
+	switch {
+	case strings.HasPrefix(imageRef, "@"):
+		var urls []string
+		urls, params.Alias, err = pp.resolveAlias(imageRef)
+		if err == nil {
+			imageURL, params.Mirrors = urls[0], urls[1:]
 		}
+	case sourcePrefix(imageRef) != "":
+		imageURL, err = pp.parseSourcePath(imageRef)
+	default:
+		imageURL, err = pp.parseImageURL(imageRef)
 	}
-
-	// Parsear y validar URL
-	imageURL, err := pp.parseImageURL(matches[3])
 	if err != nil {
-		return nil, err
+		return err
 	}
 	params.URL = imageURL
+	params.Ref = imageRef
 
-	// Obtener origin de query parameters
-	if origin := r.URL.Query().Get("origin"); origin != "" {
+	if origin != "" {
 		params.Origin = strings.Trim(origin, `"`)
 	}
+	return nil
+}
+
+// ParsePreset parsea las transformaciones de un preset configurado
+func (pp *ParamsParser) ParsePreset(name string) (*ImageParams, error) {
+	if pp.config == nil || pp.config.Presets[name] == "" {
+		return nil, fmt.Errorf("%w: unknown preset %q", ErrInvalidParams, name)
+	}
+	return pp.ParseTransformations(pp.config.Presets[name])
+}
+
+// ParseTransformations parsea una lista de transformaciones ("w_400,q_90") sobre los valores por defecto
+func (pp *ParamsParser) ParseTransformations(spec string) (*ImageParams, error) {
+	params := pp.GetDefaultParams()
+	if spec == "" {
+		return params, nil
+	}
+
+	for _, token := range strings.Split(spec, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(token), "_")
+		switch name {
+		case "w":
+			w, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid width %q", ErrInvalidParams, value)
+			}
+			if err := pp.validateWidth(w); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+			}
+			params.Width = w
+		case "q":
+			q, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid quality %q", ErrInvalidParams, value)
+			}
+			if err := pp.validateQuality(q); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+			}
+			params.Quality = q
+		case "f":
+			format := value
+			if format == "jpg" {
+				format = "jpeg"
+			}
+			if _, ok := outputContentTypes[format]; !ok {
+				return nil, fmt.Errorf("%w: unsupported output format %q", ErrInvalidParams, value)
+			}
+			params.Format = format
+		default:
+			return nil, fmt.Errorf("%w: unknown transformation %q", ErrInvalidParams, token)
+		}
+	}
 
 	return params, nil
 }
 
+// ParseTags valida una lista de etiquetas de caché, descartando vacías y duplicadas
+func ParseTags(values []string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		tag := strings.TrimSpace(value)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if !tagRe.MatchString(tag) {
+			return nil, fmt.Errorf("%w: invalid tag %q", ErrInvalidParams, tag)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags per image", ErrInvalidParams, maxTags)
+	}
+	return tags, nil
+}
+
 // parseImageURL procesa y valida la URL de la imagen
 func (pp *ParamsParser) parseImageURL(rawURL string) (string, error) {
 	// Decodificar URL encoding
@@ -111,6 +253,60 @@ func (pp *ParamsParser) parseImageURL(rawURL string) (string, error) {
 	return parsedURL.String(), nil
 }
 
+// parseSourcePath valida una referencia con prefijo de fuente ("local:/ruta", "s3:/ruta")
+func (pp *ParamsParser) parseSourcePath(rawPath string) (string, error) {
+	prefix := sourcePrefix(rawPath)
+	decodedPath, err := url.PathUnescape(strings.TrimPrefix(rawPath, prefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode URL: %v", err)
+	}
+
+	cleaned, err := cleanLocalPath(decodedPath)
+	if err != nil {
+		return "", err
+	}
+	return prefix + "/" + cleaned, nil
+}
+
+// resolveAlias convierte "@alias/ruta" en las URLs completas a partir de las URLs base del alias.
+// La primera URL es la del origen principal y el resto las de sus mirrors, en orden.
+func (pp *ParamsParser) resolveAlias(rawPath string) ([]string, string, error) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(rawPath, "@"), "/")
+	if pp.config == nil || pp.config.Aliases[name] == nil {
+		return nil, "", fmt.Errorf("unknown source alias: %s", name)
+	}
+
+	decodedPath, err := url.PathUnescape(rest)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode URL: %v", err)
+	}
+	if decodedPath == "" {
+		return nil, "", fmt.Errorf("missing image path for alias: %s", name)
+	}
+
+	var urls []string
+	for _, base := range pp.config.Aliases[name].Mirrors {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid base URL for alias %s: %v", name, err)
+		}
+
+		// Evitar que "../" escape del directorio base del alias
+		basePath := strings.TrimSuffix(baseURL.Path, "/") + "/"
+		resolvedPath := path.Clean(basePath + decodedPath)
+		if !strings.HasPrefix(resolvedPath, basePath) {
+			return nil, "", fmt.Errorf("invalid image path for alias: %s", name)
+		}
+
+		resolved := *baseURL
+		resolved.Path = resolvedPath
+		resolved.RawPath = ""
+		urls = append(urls, resolved.String())
+	}
+
+	return urls, name, nil
+}
+
 // validateWidth valida el parámetro de ancho
 func (pp *ParamsParser) validateWidth(width int) error {
 	if width <= 0 {
@@ -138,6 +334,7 @@ func (pp *ParamsParser) GetDefaultParams() *ImageParams {
 	return &ImageParams{
 		Width:   400,
 		Quality: 90,
+		Format:  "jpeg",
 		URL:     "",
 		Origin:  "",
 	}
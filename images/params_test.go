@@ -0,0 +1,75 @@
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// parseTestRequest parsea una petición a /api/image con la ruta indicada como parámetro de chi
+func parseTestRequest(parser *ParamsParser, path string) (*ImageParams, error) {
+	r := httptest.NewRequest("GET", "/api/image/"+path, nil)
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("*", path)
+	return parser.ParseURLParams(r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext)))
+}
+
+// TestResolveAlias verifica que "@alias/ruta" se resuelva contra la URL base sin poder salir de ella
+func TestResolveAlias(t *testing.T) {
+	var config Config
+	if err := json.Unmarshal([]byte(`{"aliases": {"products": "https://cdn.example.com/img/products/"}}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	parser := NewParamsParser(&config)
+
+	params, err := parseTestRequest(parser, "w_400/@products/shoes/red%20shoe.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.URL != "https://cdn.example.com/img/products/shoes/red%20shoe.jpg" || params.Alias != "products" {
+		t.Errorf("URL = %s, alias = %s", params.URL, params.Alias)
+	}
+
+	for _, path := range []string{
+		"w_400/@unknown/a.jpg",
+		"w_400/@products/",
+		"w_400/@products/../secret.jpg",
+		"w_400/@products/shoes/%2e%2e/%2e%2e/secret.jpg",
+	} {
+		if _, err := parseTestRequest(parser, path); err == nil {
+			t.Errorf("%s was accepted, want an error", path)
+		}
+	}
+}
+
+// TestCacheKeyIgnoresQualityForLosslessFormats verifica que PNG y GIF compartan la entrada sin importar q
+func TestCacheKeyIgnoresQualityForLosslessFormats(t *testing.T) {
+	parser := NewParamsParser(nil)
+
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"w_400,q_50,f_png", "w_400,f_png", true},
+		{"w_400,q_50,f_gif", "w_400,q_80,f_gif", true},
+		{"w_400,q_50,f_jpeg", "w_400,q_80,f_jpeg", false},
+		{"w_400,q_50,f_png", "w_400,q_50,f_jpeg", false},
+	}
+
+	for _, tt := range tests {
+		a, err := parser.ParsePath(tt.a+"/example.com/a.jpg", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := parser.ParsePath(tt.b+"/example.com/a.jpg", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same := a.CacheKey() == b.CacheKey(); same != tt.same {
+			t.Errorf("CacheKey(%s) == CacheKey(%s) is %v, want %v", tt.a, tt.b, same, tt.same)
+		}
+	}
+}
@@ -21,8 +21,34 @@ func NewImageProcessor() *ImageProcessor {
 	return &ImageProcessor{}
 }
 
+// outputContentTypes relaciona los formatos de salida soportados con su content type
+var outputContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// ContentTypeFor retorna el content type de un formato de salida
+func ContentTypeFor(format string) string {
+	if contentType, ok := outputContentTypes[format]; ok {
+		return contentType
+	}
+	return "image/jpeg"
+}
+
 // ProcessImage redimensiona y optimiza una imagen
-func (ip *ImageProcessor) ProcessImage(imageData []byte, width, quality int) ([]byte, error) {
+func (ip *ImageProcessor) ProcessImage(imageData []byte, width, quality int, format string) ([]byte, error) {
+	img, err := ip.DecodeImage(imageData)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, err := ip.EncodeVariant(img, width, quality, format)
+	return data, err
+}
+
+// DecodeImage decodifica una imagen en cualquiera de los formatos de entrada soportados
+func (ip *ImageProcessor) DecodeImage(imageData []byte) (image.Image, error) {
 	// Registrar formatos de imagen soportados
 	image.RegisterFormat("jpeg", "\xff\xd8", jpeg.Decode, jpeg.DecodeConfig)
 	image.RegisterFormat("png", "\x89PNG\r\n\x1a\n", png.Decode, png.DecodeConfig)
@@ -34,18 +60,34 @@ func (ip *ImageProcessor) ProcessImage(imageData []byte, width, quality int) ([]
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image (format: %s): %v", format, err)
 	}
+	return img, nil
+}
 
+// EncodeVariant redimensiona una imagen ya decodificada y la codifica en el formato indicado.
+// Retorna también las dimensiones reales del resultado.
+func (ip *ImageProcessor) EncodeVariant(img image.Image, width, quality int, format string) ([]byte, image.Point, error) {
 	// Redimensionar imagen manteniendo aspect ratio
 	resizedImg := imaging.Resize(img, width, 0, imaging.Lanczos)
 
-	// Codificar como JPEG con calidad especificada
+	// Codificar en el formato de salida
 	var buf bytes.Buffer
-	options := &jpeg.Options{Quality: quality}
-	if err := jpeg.Encode(&buf, resizedImg, options); err != nil {
-		return nil, fmt.Errorf("failed to encode image: %v", err)
+	var err error
+	switch format {
+	case "png":
+		encoder := &png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, resizedImg)
+	case "gif":
+		err = gif.Encode(&buf, resizedImg, nil)
+	default:
+		// JPEG con calidad especificada
+		options := &jpeg.Options{Quality: quality}
+		err = jpeg.Encode(&buf, resizedImg, options)
+	}
+	if err != nil {
+		return nil, image.Point{}, fmt.Errorf("failed to encode image: %v", err)
 	}
 
-	return buf.Bytes(), nil
+	return buf.Bytes(), resizedImg.Bounds().Size(), nil
 }
 
 // ValidateImageURL verifica si la URL apunta a una imagen válida
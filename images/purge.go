@@ -0,0 +1,90 @@
+package images
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// purgeFiller es el carácter que se agrega a un prefijo para normalizarlo como una ruta completa
+const purgeFiller = "_"
+
+// PurgeSource elimina todas las variantes de una imagen (URL, @alias/ruta o fuente con prefijo)
+func (io *ImageOptimizer) PurgeSource(imageRef string) (int, error) {
+	sourceURL, err := io.resolvePurgeRef(imageRef)
+	if err != nil {
+		return 0, err
+	}
+	match := func(candidate string) bool {
+		return candidate == sourceURL
+	}
+	io.dimensions.removeWhere(match)
+	return io.cacheManager.PurgeWhere(match), nil
+}
+
+// PurgePrefix elimina las variantes de todas las imágenes cuya URL comienza con el prefijo indicado.
+// El prefijo puede ser una URL o un @alias/ruta.
+func (io *ImageOptimizer) PurgePrefix(prefix string) (int, error) {
+	// Se normaliza el prefijo seguido de un carácter de relleno, para que un prefijo
+	// como "@alias/" o "local:/" (sin ruta de imagen) sea válido y conserve la barra final
+	resolved, err := io.resolvePurgeRef(prefix + purgeFiller)
+	if err != nil {
+		return 0, err
+	}
+	resolved = strings.TrimSuffix(resolved, purgeFiller)
+	match := func(candidate string) bool {
+		return strings.HasPrefix(candidate, resolved)
+	}
+	io.dimensions.removeWhere(match)
+	return io.cacheManager.PurgeWhere(match), nil
+}
+
+// PurgeHost elimina las variantes de todas las imágenes servidas por un host de origen
+func (io *ImageOptimizer) PurgeHost(host string) int {
+	match := func(candidate string) bool {
+		parsedURL, err := url.Parse(candidate)
+		return err == nil && strings.EqualFold(parsedURL.Host, host)
+	}
+	io.dimensions.removeWhere(match)
+	return io.cacheManager.PurgeWhere(match)
+}
+
+// PurgeVariant elimina una variante concreta, indicada con la misma ruta que GET /api/image
+// ("w_400,q_90/ejemplo.com/a.jpg") y su origin
+func (io *ImageOptimizer) PurgeVariant(variantPath, origin string) (int, error) {
+	params, err := io.paramsParser.ParsePath(variantPath, origin)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	if io.cacheManager.PurgeKey(io.cacheManager.GenerateCacheKey(params.CacheKey(), params.Format)) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// PurgeTags elimina las variantes asociadas a alguna de las etiquetas indicadas
+func (io *ImageOptimizer) PurgeTags(values []string) (int, error) {
+	tags, err := ParseTags(values)
+	if err != nil {
+		return 0, err
+	}
+	if len(tags) == 0 {
+		return 0, fmt.Errorf("%w: at least one tag is required", ErrInvalidParams)
+	}
+	return io.cacheManager.PurgeTags(tags), nil
+}
+
+// FlushCache elimina todas las entradas del caché
+func (io *ImageOptimizer) FlushCache() int {
+	io.dimensions.removeWhere(func(string) bool { return true })
+	return io.cacheManager.Flush()
+}
+
+// resolvePurgeRef normaliza una referencia de imagen igual que al generar sus variantes
+func (io *ImageOptimizer) resolvePurgeRef(imageRef string) (string, error) {
+	params := io.paramsParser.GetDefaultParams()
+	if err := io.paramsParser.ParseSource(params, strings.TrimPrefix(imageRef, "/"), ""); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	return params.URL, nil
+}
@@ -0,0 +1,226 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrOriginRateLimited indica que se superó el presupuesto de peticiones hacia el host de origen
+var ErrOriginRateLimited = errors.New("origin rate limit exceeded")
+
+const (
+	// maxHostLimiters limita cuántos hosts tienen limitador a la vez; con reglas comodín ("*")
+	// la cantidad de hostnames distintos no está acotada
+	maxHostLimiters = 1024
+	// limiterIdleTimeout es el tiempo sin uso tras el cual un limitador puede descartarse;
+	// para entonces su bucket está lleno y recrearlo no cambia el presupuesto
+	limiterIdleTimeout = 10 * time.Minute
+)
+
+// RateLimitConfig define el presupuesto de peticiones y ancho de banda hacia un host de origen
+type RateLimitConfig struct {
+	RequestsPerSecond float64  `json:"requests_per_second"` // 0 = sin límite
+	Burst             int      `json:"burst"`               // peticiones permitidas en ráfaga (mínimo 1)
+	BytesPerSecond    int64    `json:"bytes_per_second"`    // 0 = sin límite
+	MaxWait           Duration `json:"max_wait"`            // tiempo máximo en cola; 0 = rechazar sin esperar
+}
+
+// tokenBucket implementa un token bucket que admite reservas a crédito
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens por segundo
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket crea un bucket lleno
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// reserve consume n tokens y retorna cuánto hay que esperar para que estén disponibles
+func (tb *tokenBucket) reserve(n float64) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+
+	tb.tokens -= n
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// release devuelve tokens de una reserva que no se utilizará
+func (tb *tokenBucket) release(n float64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.tokens += n
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+}
+
+// hostLimiter aplica el presupuesto de un host de origen
+type hostLimiter struct {
+	requests *tokenBucket // nil si no hay límite de peticiones
+	bytes    *tokenBucket // nil si no hay límite de ancho de banda
+	maxWait  time.Duration
+	lastUsed time.Time // protegido por el lock de limiterRegistry
+}
+
+// newHostLimiter crea el limitador de un host a partir de su configuración
+func newHostLimiter(config *RateLimitConfig) *hostLimiter {
+	limiter := &hostLimiter{maxWait: config.MaxWait.Duration}
+	if config.RequestsPerSecond > 0 {
+		burst := float64(config.Burst)
+		if burst < 1 {
+			burst = 1
+		}
+		limiter.requests = newTokenBucket(config.RequestsPerSecond, burst)
+	}
+	if config.BytesPerSecond > 0 {
+		// Se permite un segundo de transferencia en ráfaga
+		limiter.bytes = newTokenBucket(float64(config.BytesPerSecond), float64(config.BytesPerSecond))
+	}
+	return limiter
+}
+
+// waitRequest espera un turno para enviar una petición, o la rechaza si la cola supera maxWait
+func (hl *hostLimiter) waitRequest(ctx context.Context, host string) error {
+	if hl.requests == nil {
+		return nil
+	}
+
+	wait := hl.requests.reserve(1)
+	if wait == 0 {
+		return nil
+	}
+	if wait > hl.maxWait {
+		hl.requests.release(1)
+		return fmt.Errorf("%w: %s", ErrOriginRateLimited, host)
+	}
+	if err := sleepContext(ctx, wait); err != nil {
+		// La petición se canceló en la cola: su turno queda libre para las siguientes
+		hl.requests.release(1)
+		return err
+	}
+	return nil
+}
+
+// limiterRegistry guarda los limitadores por hostname, descartando los inactivos
+// cuando se alcanza maxHostLimiters
+type limiterRegistry struct {
+	mu       sync.Mutex
+	limiters map[string]*hostLimiter
+}
+
+// get retorna el limitador del host, creándolo con la configuración indicada si no existe
+func (lr *limiterRegistry) get(hostname string, config *RateLimitConfig, now time.Time) *hostLimiter {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	if limiter, ok := lr.limiters[hostname]; ok {
+		limiter.lastUsed = now
+		return limiter
+	}
+
+	if lr.limiters == nil {
+		lr.limiters = make(map[string]*hostLimiter)
+	}
+	if len(lr.limiters) >= maxHostLimiters {
+		lr.evict(now)
+	}
+
+	limiter := newHostLimiter(config)
+	limiter.lastUsed = now
+	lr.limiters[hostname] = limiter
+	return limiter
+}
+
+// evict descarta los limitadores inactivos y, si no alcanza, el usado hace más tiempo; requiere el lock
+func (lr *limiterRegistry) evict(now time.Time) {
+	var oldestHost string
+	var oldest time.Time
+	for hostname, limiter := range lr.limiters {
+		if now.Sub(limiter.lastUsed) > limiterIdleTimeout {
+			delete(lr.limiters, hostname)
+			continue
+		}
+		if oldestHost == "" || limiter.lastUsed.Before(oldest) {
+			oldestHost, oldest = hostname, limiter.lastUsed
+		}
+	}
+	if len(lr.limiters) >= maxHostLimiters {
+		delete(lr.limiters, oldestHost)
+	}
+}
+
+// size retorna la cantidad de limitadores registrados
+func (lr *limiterRegistry) size() int {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return len(lr.limiters)
+}
+
+// throttleReader limita la velocidad de lectura del cuerpo de la respuesta
+func (hl *hostLimiter) throttleReader(ctx context.Context, reader io.Reader) io.Reader {
+	if hl.bytes == nil {
+		return reader
+	}
+	return &throttledReader{ctx: ctx, reader: reader, bucket: hl.bytes}
+}
+
+// throttledReader consume tokens del bucket por cada bloque leído
+type throttledReader struct {
+	ctx    context.Context
+	reader io.Reader
+	bucket *tokenBucket
+}
+
+// Read lee un bloque y espera hasta que el presupuesto de bytes lo permita
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	// Limitar el tamaño del bloque para repartir la espera de forma uniforme
+	if max := int(tr.bucket.burst); len(p) > max {
+		p = p[:max]
+	}
+
+	n, err := tr.reader.Read(p)
+	if n > 0 {
+		if waitErr := sleepContext(tr.ctx, tr.bucket.reserve(float64(n))); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// sleepContext espera la duración indicada o hasta que el contexto se cancele
+func sleepContext(ctx context.Context, wait time.Duration) error {
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
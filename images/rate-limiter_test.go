@@ -0,0 +1,68 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestWaitRequestReleasesOnCancel verifica que una petición cancelada en la cola devuelva su turno
+func TestWaitRequestReleasesOnCancel(t *testing.T) {
+	limiter := newHostLimiter(&RateLimitConfig{
+		RequestsPerSecond: 1,
+		Burst:             1,
+		MaxWait:           Duration{time.Minute},
+	})
+	if err := limiter.waitRequest(context.Background(), "origin.test"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.waitRequest(ctx, "origin.test"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waitRequest error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Sin la devolución la siguiente petición esperaría dos turnos en lugar de uno
+	if wait := limiter.requests.reserve(1); wait > time.Second {
+		t.Errorf("next request waits %v, want at most 1s", wait)
+	}
+}
+
+func TestWaitRequestRejectsBeyondMaxWait(t *testing.T) {
+	limiter := newHostLimiter(&RateLimitConfig{RequestsPerSecond: 1, Burst: 1})
+	if err := limiter.waitRequest(context.Background(), "origin.test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.waitRequest(context.Background(), "origin.test"); !errors.Is(err, ErrOriginRateLimited) {
+		t.Fatalf("waitRequest error = %v, want %v", err, ErrOriginRateLimited)
+	}
+}
+
+func TestLimiterRegistryEviction(t *testing.T) {
+	var registry limiterRegistry
+	config := &RateLimitConfig{RequestsPerSecond: 10}
+	start := time.Now()
+
+	for i := 0; i < maxHostLimiters; i++ {
+		registry.get(fmt.Sprintf("host-%d.test", i), config, start)
+	}
+	first := registry.get("host-0.test", config, start.Add(time.Second))
+
+	// Al llenarse se descarta el usado hace más tiempo, no el recién accedido
+	registry.get("new.test", config, start.Add(2*time.Second))
+	if registry.size() != maxHostLimiters {
+		t.Fatalf("size = %d, want %d", registry.size(), maxHostLimiters)
+	}
+	if registry.get("host-0.test", config, start.Add(3*time.Second)) != first {
+		t.Error("recently used limiter was evicted")
+	}
+
+	// Los inactivos se descartan todos juntos
+	registry.get("late.test", config, start.Add(limiterIdleTimeout+time.Hour))
+	if registry.size() != 1 {
+		t.Errorf("size = %d after idle eviction, want 1", registry.size())
+	}
+}
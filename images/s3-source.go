@@ -0,0 +1,234 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Prefix identifica las imágenes servidas desde almacenamiento compatible con S3
+const S3Prefix = "s3:"
+
+// emptyPayloadHash es el SHA-256 de un cuerpo vacío, usado al firmar peticiones GET
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Config contiene la configuración del bucket de origen
+type S3Config struct {
+	Bucket          string
+	Prefix          string
+	Region          string
+	Endpoint        string // vacío = endpoint de AWS para la región
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	PathStyle       bool             // requerido por MinIO y la mayoría de servicios compatibles
+	Transport       *TransportConfig // proxy y TLS para las peticiones al endpoint
+}
+
+// S3Source lee imágenes originales desde un bucket compatible con S3 usando firmas SigV4
+type S3Source struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Source crea una nueva fuente S3
+func NewS3Source(config S3Config) (*S3Source, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %s", config.Endpoint)
+	}
+
+	transport, err := NewTransport(config.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Source{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Transport: transport},
+	}, nil
+}
+
+// Fetch descarga un objeto a partir de una referencia "s3:/ruta/imagen.jpg"
+func (ss *S3Source) Fetch(imageRef, origin string) (*FetchedImage, error) {
+	objectPath, err := cleanLocalPath(strings.TrimPrefix(imageRef, S3Prefix))
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimSuffix(ss.config.Prefix, "/")
+	if key != "" {
+		key += "/"
+	}
+	key += objectPath
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ss.objectURL(key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	ss.signRequest(req, time.Now().UTC())
+
+	resp, err := ss.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("failed to download image: status %d (%w)", resp.StatusCode, ErrSourceNotFound)
+	case resp.StatusCode == http.StatusForbidden:
+		// S3 también responde 403 a objetos inexistentes si las credenciales no pueden listar el bucket
+		return nil, fmt.Errorf("failed to download image: status %d (%w)", resp.StatusCode, ErrSourceForbidden)
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("failed to download image: status %d (%w)", resp.StatusCode, ErrOriginUnavailable)
+	default:
+		return nil, fmt.Errorf("failed to download image: status %d", resp.StatusCode)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to read image data: %v", err)
+	}
+
+	// Los objetos subidos sin Content-Type se validan por su contenido
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(buf.Bytes())
+	}
+	processor := NewImageProcessor()
+	if err := processor.ValidateImageURL(contentType); err != nil {
+		return nil, err
+	}
+
+	return &FetchedImage{
+		Data:   buf.Bytes(),
+		Header: resp.Header,
+	}, nil
+}
+
+// objectURL construye la URL del objeto con estilo path o virtual-host
+func (ss *S3Source) objectURL(key string) string {
+	objectURL := *ss.endpoint
+	escapedKey := s3URIEncode(key, false)
+	basePath := strings.TrimSuffix(objectURL.Path, "/")
+
+	if ss.config.PathStyle {
+		objectURL.Path = basePath + "/" + ss.config.Bucket + "/" + key
+		objectURL.RawPath = basePath + "/" + s3URIEncode(ss.config.Bucket, true) + "/" + escapedKey
+	} else {
+		objectURL.Host = ss.config.Bucket + "." + objectURL.Host
+		objectURL.Path = basePath + "/" + key
+		objectURL.RawPath = basePath + "/" + escapedKey
+	}
+	return objectURL.String()
+}
+
+// signRequest firma la petición con AWS Signature Version 4.
+// Sin credenciales la petición se envía de forma anónima (buckets públicos).
+func (ss *S3Source) signRequest(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if ss.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", ss.config.SessionToken)
+	}
+
+	if ss.config.AccessKeyID == "" || ss.config.SecretAccessKey == "" {
+		return
+	}
+
+	// Headers firmados en minúsculas y orden alfabético
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + ss.config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+ss.config.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, ss.config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		ss.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 calcula el HMAC-SHA256 de un mensaje
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// s3URIEncode codifica según las reglas de SigV4: sólo se conservan los caracteres no reservados.
+// Las barras se conservan salvo que encodeSlash sea true.
+func s3URIEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			encoded.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			encoded.WriteByte(c)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
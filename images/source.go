@@ -0,0 +1,91 @@
+package images
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSourceNotFound indica que la imagen no existe en la fuente
+var ErrSourceNotFound = errors.New("image not found in source")
+
+// ErrSourceForbidden indica que la fuente rechazó el acceso a la imagen
+var ErrSourceForbidden = errors.New("access to image denied by source")
+
+// Source obtiene imágenes originales a partir de una referencia (URL o ruta con prefijo)
+type Source interface {
+	Fetch(imageRef, origin string) (*FetchedImage, error)
+}
+
+// Validators contiene los validadores de un original descargado previamente
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// ConditionalSource es implementado por las fuentes que soportan peticiones condicionales.
+// Si el original no cambió, FetchIfModified retorna una imagen sin datos con NotModified
+// y los headers de la respuesta, que pueden renovar el TTL.
+type ConditionalSource interface {
+	FetchIfModified(imageRef, origin string, validators Validators) (*FetchedImage, error)
+}
+
+// SourceRouter elige la fuente según el prefijo de la referencia (local:, s3:, ...).
+// Las referencias sin prefijo registrado se envían a la fuente por defecto.
+type SourceRouter struct {
+	sources  map[string]Source
+	fallback Source
+}
+
+// NewSourceRouter crea un enrutador con la fuente por defecto indicada
+func NewSourceRouter(fallback Source) *SourceRouter {
+	return &SourceRouter{
+		sources:  make(map[string]Source),
+		fallback: fallback,
+	}
+}
+
+// Register asocia un prefijo de referencia con una fuente
+func (sr *SourceRouter) Register(prefix string, source Source) {
+	sr.sources[prefix] = source
+}
+
+// Fetch obtiene la imagen desde la fuente que corresponde a la referencia
+func (sr *SourceRouter) Fetch(imageRef, origin string) (*FetchedImage, error) {
+	prefix := sourcePrefix(imageRef)
+	if prefix == "" {
+		return sr.fallback.Fetch(imageRef, origin)
+	}
+
+	source, ok := sr.sources[prefix]
+	if !ok {
+		return nil, fmt.Errorf("source %q is not configured", strings.TrimSuffix(prefix, ":"))
+	}
+	return source.Fetch(imageRef, origin)
+}
+
+// FetchIfModified hace una petición condicional si la fuente de la referencia la soporta;
+// en caso contrario descarga la imagen completa
+func (sr *SourceRouter) FetchIfModified(imageRef, origin string, validators Validators) (*FetchedImage, error) {
+	source := sr.fallback
+	if prefix := sourcePrefix(imageRef); prefix != "" {
+		source = sr.sources[prefix]
+	}
+	if conditional, ok := source.(ConditionalSource); ok {
+		return conditional.FetchIfModified(imageRef, origin, validators)
+	}
+	return sr.Fetch(imageRef, origin)
+}
+
+// sourcePrefixes contiene los prefijos de las fuentes que no usan HTTP directo
+var sourcePrefixes = []string{LocalPrefix, S3Prefix}
+
+// sourcePrefix retorna el prefijo de fuente de una referencia, o "" si es una URL HTTP
+func sourcePrefix(imageRef string) string {
+	for _, prefix := range sourcePrefixes {
+		if strings.HasPrefix(imageRef, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
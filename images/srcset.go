@@ -0,0 +1,248 @@
+package images
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxSrcsetWidths limita los anchos de un srcset
+const maxSrcsetWidths = 12
+
+// SrcsetRequest describe el srcset a generar para una imagen
+type SrcsetRequest struct {
+	URL         string // URL, @alias/ruta o fuente con prefijo (local:/, s3:/)
+	Origin      string
+	Widths      []int    // anchos explícitos
+	Breakpoints string   // conjunto de anchos configurado (alternativa a Widths)
+	Formats     []string // formatos de salida; por defecto jpeg
+	Quality     int      // 0 = calidad por defecto
+	Sizes       string   // atributo sizes; por defecto 100vw
+	Alt         string
+}
+
+// SrcsetCandidate es una variante de un srcset con sus dimensiones reales
+type SrcsetCandidate struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// PictureSource es un elemento <source> de <picture>
+type PictureSource struct {
+	Type       string            `json:"type"`
+	Format     string            `json:"format"`
+	Srcset     string            `json:"srcset"`
+	Candidates []SrcsetCandidate `json:"candidates"`
+}
+
+// PictureImg es el <img> de respaldo de <picture>
+type PictureImg struct {
+	Src    string `json:"src"`
+	Srcset string `json:"srcset"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// SrcsetResult contiene los srcset por formato y el marcado <picture> listo para usar
+type SrcsetResult struct {
+	Source  string            `json:"source"`
+	Width   int               `json:"width"`  // ancho de la imagen original
+	Height  int               `json:"height"` // alto de la imagen original
+	Sizes   string            `json:"sizes"`
+	Srcset  map[string]string `json:"srcset"`  // formato -> srcset
+	Sources []PictureSource   `json:"sources"` // <source> en orden de preferencia
+	Img     PictureImg        `json:"img"`
+	Picture string            `json:"picture"`
+}
+
+// BuildSrcset genera los srcset y el marcado <picture> de una imagen usando sus dimensiones reales.
+// Los anchos mayores que el original se descartan para no ampliar la imagen.
+func (io *ImageOptimizer) BuildSrcset(req *SrcsetRequest) (*SrcsetResult, error) {
+	widths, err := io.srcsetWidths(req)
+	if err != nil {
+		return nil, err
+	}
+
+	formats := req.Formats
+	if len(formats) == 0 {
+		formats = []string{"jpeg"}
+	}
+
+	source := io.paramsParser.GetDefaultParams()
+	if err := io.paramsParser.ParseSource(source, req.URL, req.Origin); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	if err := io.checkOrigin(source); err != nil {
+		return nil, err
+	}
+
+	// Validar formatos y calidad con el mismo parser que las URLs de imagen
+	variants := make([]*ImageParams, len(formats))
+	for i, format := range formats {
+		spec := "f_" + strings.ToLower(strings.TrimSpace(format))
+		if req.Quality > 0 {
+			spec += fmt.Sprintf(",q_%d", req.Quality)
+		}
+		params, err := io.paramsParser.ParseTransformations(spec)
+		if err != nil {
+			return nil, err
+		}
+		params.URL, params.Origin, params.Alias = source.URL, source.Origin, source.Alias
+		params.Mirrors, params.Ref = source.Mirrors, source.Ref
+		variants[i] = params
+	}
+
+	// Dimensiones reales de la imagen original
+	srcWidth, srcHeight, err := io.originalDimensions(source)
+	if err != nil {
+		return nil, err
+	}
+	widths = fitWidths(widths, srcWidth)
+
+	sizes := req.Sizes
+	if sizes == "" {
+		sizes = "100vw"
+	}
+
+	result := &SrcsetResult{
+		Source:  source.URL,
+		Width:   srcWidth,
+		Height:  srcHeight,
+		Sizes:   sizes,
+		Srcset:  make(map[string]string),
+		Sources: []PictureSource{},
+	}
+
+	// El <img> de respaldo usa JPEG si se solicitó, si no el último formato
+	fallback := variants[len(variants)-1]
+	for _, params := range variants {
+		if params.Format == "jpeg" {
+			fallback = params
+			break
+		}
+	}
+
+	for _, params := range variants {
+		var candidates []SrcsetCandidate
+		var entries []string
+		for _, width := range widths {
+			variant := *params
+			variant.Width = width
+			candidate := SrcsetCandidate{
+				URL:    VariantURL(&variant),
+				Width:  width,
+				Height: scaledHeight(srcWidth, srcHeight, width),
+			}
+			candidates = append(candidates, candidate)
+			entries = append(entries, fmt.Sprintf("%s %dw", candidate.URL, candidate.Width))
+		}
+		srcset := strings.Join(entries, ", ")
+		result.Srcset[params.Format] = srcset
+
+		if params == fallback {
+			largest := candidates[len(candidates)-1]
+			result.Img = PictureImg{Src: largest.URL, Srcset: srcset, Width: largest.Width, Height: largest.Height}
+			continue
+		}
+		result.Sources = append(result.Sources, PictureSource{
+			Type:       params.ContentType(),
+			Format:     params.Format,
+			Srcset:     srcset,
+			Candidates: candidates,
+		})
+	}
+
+	result.Picture = pictureMarkup(result, req.Alt)
+	return result, nil
+}
+
+// originalDimensions obtiene el ancho y alto del original, descargándolo sólo si no se
+// conocen de una petición anterior
+func (io *ImageOptimizer) originalDimensions(source *ImageParams) (int, int, error) {
+	now := time.Now()
+	if width, height, ok := io.dimensions.get(source.URL, now); ok {
+		return width, height, nil
+	}
+
+	fetched, err := io.fetchOriginal(source)
+	if err != nil {
+		return 0, 0, fmt.Errorf("download error: %w", err)
+	}
+	info, err := io.processor.GetImageInfo(fetched.Data)
+	if err != nil {
+		return 0, 0, fmt.Errorf("processing error: %v", err)
+	}
+	width, height := info["width"].(int), info["height"].(int)
+	io.dimensions.put(source.URL, width, height, now.Add(io.cacheManager.CacheDuration))
+	return width, height, nil
+}
+
+// srcsetWidths obtiene los anchos solicitados, ordenados y sin duplicados
+func (io *ImageOptimizer) srcsetWidths(req *SrcsetRequest) ([]int, error) {
+	widths := req.Widths
+	if req.Breakpoints != "" {
+		if io.config == nil || len(io.config.Breakpoints[req.Breakpoints]) == 0 {
+			return nil, fmt.Errorf("%w: unknown breakpoints %q", ErrInvalidParams, req.Breakpoints)
+		}
+		widths = io.config.Breakpoints[req.Breakpoints]
+	}
+	if len(widths) == 0 {
+		return nil, fmt.Errorf("%w: widths or breakpoints are required", ErrInvalidParams)
+	}
+	if len(widths) > maxSrcsetWidths {
+		return nil, fmt.Errorf("%w: at most %d widths per srcset", ErrInvalidParams, maxSrcsetWidths)
+	}
+
+	seen := make(map[int]bool)
+	var sorted []int
+	for _, width := range widths {
+		if err := io.paramsParser.validateWidth(width); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+		}
+		if !seen[width] {
+			seen[width] = true
+			sorted = append(sorted, width)
+		}
+	}
+	sort.Ints(sorted)
+	return sorted, nil
+}
+
+// fitWidths descarta los anchos mayores que el original, conservando el ancho original como máximo
+func fitWidths(widths []int, srcWidth int) []int {
+	var fitted []int
+	for _, width := range widths {
+		if width < srcWidth {
+			fitted = append(fitted, width)
+		}
+	}
+	if len(fitted) < len(widths) {
+		fitted = append(fitted, srcWidth)
+	}
+	return fitted
+}
+
+// scaledHeight calcula el alto resultante igual que imaging.Resize con alto 0
+func scaledHeight(srcWidth, srcHeight, width int) int {
+	height := float64(width) * float64(srcHeight) / float64(srcWidth)
+	return int(math.Max(1.0, math.Floor(height+0.5)))
+}
+
+// pictureMarkup genera el elemento <picture> con sus <source> y el <img> de respaldo
+func pictureMarkup(result *SrcsetResult, alt string) string {
+	var markup strings.Builder
+	markup.WriteString("<picture>")
+	for _, source := range result.Sources {
+		fmt.Fprintf(&markup, `<source type="%s" srcset="%s" sizes="%s">`,
+			source.Type, html.EscapeString(source.Srcset), html.EscapeString(result.Sizes))
+	}
+	fmt.Fprintf(&markup, `<img src="%s" srcset="%s" sizes="%s" width="%d" height="%d" alt="%s">`,
+		html.EscapeString(result.Img.Src), html.EscapeString(result.Img.Srcset), html.EscapeString(result.Sizes),
+		result.Img.Width, result.Img.Height, html.EscapeString(alt))
+	markup.WriteString("</picture>")
+	return markup.String()
+}
@@ -0,0 +1,66 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/loxzer01/serve-img-optimized/cache"
+)
+
+// TestBuildSrcset verifica los anchos y altos calculados y que el original se descargue una sola vez
+func TestBuildSrcset(t *testing.T) {
+	var original bytes.Buffer
+	if err := png.Encode(&original, image.NewRGBA(image.Rect(0, 0, 800, 400))); err != nil {
+		t.Fatal(err)
+	}
+	var downloads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(original.Bytes())
+	}))
+	defer server.Close()
+
+	config := &Config{}
+	downloader, err := NewImageDownloader(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	optimizer := NewImageOptimizer(cache.NewCacheManager(t.TempDir(), time.Hour, 10), config, NewSourceRouter(downloader))
+
+	request := &SrcsetRequest{URL: server.URL + "/a.png", Widths: []int{1200, 400, 200, 400}}
+	for i := 0; i < 2; i++ {
+		result, err := optimizer.BuildSrcset(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Width != 800 || result.Height != 400 {
+			t.Errorf("original = %dx%d, want 800x400", result.Width, result.Height)
+		}
+		if result.Img.Width != 800 || result.Img.Height != 400 {
+			t.Errorf("largest candidate = %dx%d, want the original size", result.Img.Width, result.Img.Height)
+		}
+		if len(result.Srcset["jpeg"]) == 0 {
+			t.Errorf("srcset = %v, want a jpeg srcset", result.Srcset)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("original downloaded %d times, want 1", downloads)
+	}
+
+	// Purgar la imagen olvida sus dimensiones
+	if _, err := optimizer.PurgeSource(server.URL + "/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := optimizer.BuildSrcset(request); err != nil {
+		t.Fatal(err)
+	}
+	if downloads != 2 {
+		t.Errorf("original downloaded %d times after the purge, want 2", downloads)
+	}
+}
@@ -0,0 +1,110 @@
+package images
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// TransportConfig define el proxy de salida y la configuración TLS para las peticiones a orígenes
+type TransportConfig struct {
+	Proxy         string `json:"proxy"`           // http://, https://, socks5:// (vacío = variables HTTP(S)_PROXY)
+	CABundle      string `json:"ca_bundle"`       // certificados PEM adicionales a los del sistema
+	ClientCert    string `json:"client_cert"`     // certificado PEM para mTLS
+	ClientKey     string `json:"client_key"`      // clave privada PEM para mTLS
+	TLSMinVersion string `json:"tls_min_version"` // 1.0, 1.1, 1.2 o 1.3
+}
+
+// tlsVersions relaciona los valores de tls_min_version con las constantes de crypto/tls
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// merge combina la configuración con una más específica; los campos definidos en override tienen prioridad
+func (tc *TransportConfig) merge(override *TransportConfig) *TransportConfig {
+	merged := &TransportConfig{}
+	if tc != nil {
+		*merged = *tc
+	}
+	if override == nil {
+		return merged
+	}
+	if override.Proxy != "" {
+		merged.Proxy = override.Proxy
+	}
+	if override.CABundle != "" {
+		merged.CABundle = override.CABundle
+	}
+	if override.ClientCert != "" {
+		merged.ClientCert = override.ClientCert
+		merged.ClientKey = override.ClientKey
+	}
+	if override.TLSMinVersion != "" {
+		merged.TLSMinVersion = override.TLSMinVersion
+	}
+	return merged
+}
+
+// NewTransport crea un http.Transport a partir de la configuración
+func NewTransport(tc *TransportConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tc == nil {
+		return transport, nil
+	}
+
+	// Proxy de salida; net/http soporta http, https y socks5
+	if tc.Proxy != "" {
+		proxyURL, err := url.Parse(tc.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL: %s", tc.Proxy)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if tc.TLSMinVersion != "" {
+		version, ok := tlsVersions[tc.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tls_min_version: %s", tc.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if tc.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(tc.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in CA bundle: %s", tc.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if tc.ClientCert != "" || tc.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(tc.ClientCert, tc.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
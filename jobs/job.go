@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/loxzer01/serve-img-optimized/images"
+)
+
+// Status representa el estado de un trabajo
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Job es un trabajo de generación de variantes procesado en segundo plano
+type Job struct {
+	ID          string               `json:"id"`
+	Status      Status               `json:"status"`
+	Request     *images.BatchRequest `json:"request"`
+	Result      *images.BatchResult  `json:"result,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Attempts    int                  `json:"attempts"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+	CompletedAt *time.Time           `json:"completed_at,omitempty"`
+}
+
+// IsFinished indica si el trabajo terminó, con éxito o con error
+func (j *Job) IsFinished() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed
+}
@@ -0,0 +1,278 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/loxzer01/serve-img-optimized/images"
+)
+
+// ErrQueueFull indica que la cola alcanzó su capacidad máxima
+var ErrQueueFull = errors.New("job queue is full")
+
+// queueCapacity es el número máximo de trabajos pendientes en memoria
+const queueCapacity = 1000
+
+// Processor genera las variantes de un trabajo
+type Processor interface {
+	ValidateBatch(req *images.BatchRequest) error
+	GenerateVariants(req *images.BatchRequest) (*images.BatchResult, error)
+}
+
+// Queue es una cola de trabajos persistente en disco con un pool de workers y reintentos
+type Queue struct {
+	store       *jobStore
+	processor   Processor
+	maxAttempts int
+	retention   time.Duration // tiempo que se conservan los trabajos terminados
+
+	// Notifier recibe los trabajos terminados (completados o fallidos); nil = sin notificaciones
+	Notifier *WebhookNotifier
+
+	mu      sync.RWMutex
+	jobs    map[string]*Job
+	pending chan string
+	resumed []string // trabajos recuperados que no cupieron en la cola; entran al iniciar los workers
+}
+
+// NewQueue crea la cola y recupera los trabajos persistidos, en orden de creación.
+// Los trabajos que quedaron en ejecución al detenerse el servidor vuelven a la cola.
+func NewQueue(dir string, processor Processor, maxAttempts int, retention time.Duration) (*Queue, error) {
+	store, err := newJobStore(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job store: %v", err)
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	q := &Queue{
+		store:       store,
+		processor:   processor,
+		maxAttempts: maxAttempts,
+		retention:   retention,
+		jobs:        make(map[string]*Job),
+		pending:     make(chan string, queueCapacity),
+	}
+
+	saved, err := store.loadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jobs: %v", err)
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].CreatedAt.Before(saved[j].CreatedAt) })
+	for _, job := range saved {
+		q.jobs[job.ID] = job
+		if job.IsFinished() {
+			continue
+		}
+		job.Status = StatusQueued
+		store.save(job)
+		select {
+		case q.pending <- job.ID:
+		default:
+			q.resumed = append(q.resumed, job.ID)
+		}
+	}
+	if len(q.resumed) > 0 {
+		fmt.Printf("Job queue full, %d resumed jobs will be queued as workers free up\n", len(q.resumed))
+	}
+
+	return q, nil
+}
+
+// Start inicia los workers y la limpieza periódica de trabajos terminados
+func (q *Queue) Start(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	fmt.Printf("Starting %d job workers\n", workers)
+
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+
+	// Los trabajos recuperados que no cupieron en la cola entran a medida que se libera espacio
+	if len(q.resumed) > 0 {
+		resumed := q.resumed
+		q.resumed = nil
+		go func() {
+			for _, id := range resumed {
+				q.pending <- id
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			q.cleanup()
+		}
+	}()
+}
+
+// Submit valida y encola un nuevo trabajo
+func (q *Queue) Submit(req *images.BatchRequest) (*Job, error) {
+	if err := q.processor.ValidateBatch(req); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:        newJobID(),
+		Status:    StatusQueued,
+		Request:   req,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	q.mu.Lock()
+	if len(q.pending) >= cap(q.pending) {
+		q.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	q.jobs[job.ID] = job
+	if err := q.store.save(job); err != nil {
+		delete(q.jobs, job.ID)
+		q.mu.Unlock()
+		return nil, fmt.Errorf("failed to persist job: %v", err)
+	}
+	snapshot := *job
+	q.mu.Unlock()
+
+	q.enqueue(job.ID)
+	return &snapshot, nil
+}
+
+// Get retorna una copia del estado actual de un trabajo
+func (q *Queue) Get(id string) (*Job, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *job
+	return &snapshot, true
+}
+
+// worker procesa trabajos de la cola hasta que el servidor se detiene
+func (q *Queue) worker() {
+	for id := range q.pending {
+		q.process(id)
+	}
+}
+
+// process ejecuta un intento de un trabajo y programa un reintento si falla
+func (q *Queue) process(id string) {
+	job, ok := q.update(id, func(job *Job) {
+		job.Status = StatusRunning
+		job.Attempts++
+	})
+	if !ok {
+		return
+	}
+
+	result, err := q.processor.GenerateVariants(job.Request)
+
+	if err == nil {
+		finished, _ := q.update(id, func(job *Job) {
+			now := time.Now()
+			job.Status = StatusCompleted
+			job.Result = result
+			job.Error = ""
+			job.CompletedAt = &now
+		})
+		q.Notifier.NotifyJob(finished)
+		return
+	}
+
+	// Los errores de validación no mejoran al reintentar
+	retry := job.Attempts < q.maxAttempts && !isPermanent(err)
+	finished, _ := q.update(id, func(job *Job) {
+		job.Error = err.Error()
+		if retry {
+			job.Status = StatusQueued
+			return
+		}
+		now := time.Now()
+		job.Status = StatusFailed
+		job.CompletedAt = &now
+	})
+
+	if retry {
+		// Backoff exponencial: 2s, 4s, 8s...
+		backoff := time.Duration(1<<job.Attempts) * time.Second
+		fmt.Printf("Job %s failed (attempt %d/%d), retrying in %v: %v\n", id, job.Attempts, q.maxAttempts, backoff, err)
+		time.AfterFunc(backoff, func() { q.enqueue(id) })
+	} else {
+		fmt.Printf("Job %s failed: %v\n", id, err)
+		q.Notifier.NotifyJob(finished)
+	}
+}
+
+// update modifica un trabajo bajo el lock y lo persiste; retorna una copia del resultado
+func (q *Queue) update(id string, change func(job *Job)) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	change(job)
+	job.UpdatedAt = time.Now()
+	if err := q.store.save(job); err != nil {
+		fmt.Printf("Warning: failed to persist job %s: %v\n", id, err)
+	}
+	snapshot := *job
+	return &snapshot, true
+}
+
+// enqueue agrega un trabajo a la cola; si está llena se marca como fallido
+func (q *Queue) enqueue(id string) {
+	select {
+	case q.pending <- id:
+	default:
+		if failed, ok := q.update(id, func(job *Job) {
+			now := time.Now()
+			job.Status = StatusFailed
+			job.Error = ErrQueueFull.Error()
+			job.CompletedAt = &now
+		}); ok {
+			q.Notifier.NotifyJob(failed)
+		}
+	}
+}
+
+// cleanup elimina los trabajos terminados más antiguos que el período de retención
+func (q *Queue) cleanup() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, job := range q.jobs {
+		if job.IsFinished() && job.CompletedAt != nil && time.Since(*job.CompletedAt) > q.retention {
+			delete(q.jobs, id)
+			q.store.remove(id)
+		}
+	}
+}
+
+// isPermanent indica si un error no se resolverá reintentando
+func isPermanent(err error) bool {
+	return errors.Is(err, images.ErrInvalidParams) || errors.Is(err, images.ErrOriginNotAllowed) ||
+		errors.Is(err, images.ErrSourceNotFound) || errors.Is(err, images.ErrSourceForbidden)
+}
+
+// newJobID genera un identificador aleatorio para un trabajo
+func newJobID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/loxzer01/serve-img-optimized/images"
+)
+
+// testProcessor completa todos los trabajos y avisa cada vez que procesa uno
+type testProcessor struct {
+	processed chan string
+}
+
+func (tp *testProcessor) ValidateBatch(req *images.BatchRequest) error { return nil }
+
+func (tp *testProcessor) GenerateVariants(req *images.BatchRequest) (*images.BatchResult, error) {
+	tp.processed <- req.URL
+	return &images.BatchResult{}, nil
+}
+
+// TestResumeBeyondCapacity verifica que los trabajos recuperados que no caben en la cola se procesen igual
+func TestResumeBeyondCapacity(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := queueCapacity + 5
+	created := time.Now().Add(-time.Hour)
+	for i := 0; i < total; i++ {
+		job := &Job{
+			ID:        fmt.Sprintf("job-%04d", i),
+			Status:    StatusRunning,
+			Request:   &images.BatchRequest{URL: fmt.Sprintf("https://example.com/%d.jpg", i)},
+			CreatedAt: created.Add(time.Duration(i) * time.Millisecond),
+		}
+		if err := store.save(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	processor := &testProcessor{processed: make(chan string)}
+	queue, err := NewQueue(dir, processor, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Start(1)
+
+	timeout := time.After(10 * time.Second)
+	for i := 0; i < total; i++ {
+		select {
+		case url := <-processor.processed:
+			// Con un solo worker se procesan en orden de creación
+			if want := fmt.Sprintf("https://example.com/%d.jpg", i); url != want {
+				t.Fatalf("processed %s, want %s", url, want)
+			}
+		case <-timeout:
+			t.Fatalf("only %d of %d resumed jobs were processed", i, total)
+		}
+	}
+}
+
+// TestIsPermanent verifica qué errores fallan el trabajo sin reintentar
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		err       error
+		permanent bool
+	}{
+		{fmt.Errorf("parse: %w", images.ErrInvalidParams), true},
+		{images.ErrOriginNotAllowed, true},
+		{fmt.Errorf("download error: %w", images.ErrSourceNotFound), true},
+		{fmt.Errorf("download error: %w", images.ErrSourceForbidden), true},
+		{fmt.Errorf("download error: %w", images.ErrOriginUnavailable), false},
+		{errors.New("connection reset"), false},
+	}
+	for _, test := range tests {
+		if got := isPermanent(test.err); got != test.permanent {
+			t.Errorf("isPermanent(%v) = %v, want %v", test.err, got, test.permanent)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jobStore persiste cada trabajo como un archivo JSON en el directorio de trabajos
+type jobStore struct {
+	dir string
+}
+
+// newJobStore crea el almacenamiento, creando el directorio si no existe
+func newJobStore(dir string) (*jobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &jobStore{dir: dir}, nil
+}
+
+// save escribe el trabajo de forma atómica (archivo temporal + rename)
+func (js *jobStore) save(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(js.dir, job.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), js.path(job.ID))
+}
+
+// remove elimina el archivo de un trabajo
+func (js *jobStore) remove(id string) error {
+	return os.Remove(js.path(id))
+}
+
+// loadAll lee todos los trabajos persistidos, descartando temporales y archivos inválidos
+func (js *jobStore) loadAll() ([]*Job, error) {
+	files, err := os.ReadDir(js.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*Job
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(filepath.Join(js.dir, name))
+			continue
+		}
+		if file.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(js.dir, name))
+		if err != nil {
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil || job.ID == "" {
+			continue
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// path retorna la ruta del archivo de un trabajo
+func (js *jobStore) path(id string) string {
+	return filepath.Join(js.dir, id+".json")
+}
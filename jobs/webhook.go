@@ -0,0 +1,186 @@
+package jobs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/loxzer01/serve-img-optimized/images"
+)
+
+// Eventos enviados al webhook
+const (
+	EventJobCompleted   = "job.completed"
+	EventJobFailed      = "job.failed"
+	EventBatchCompleted = "batch.completed"
+	EventBatchFailed    = "batch.failed"
+)
+
+// WebhookEvent es el payload JSON enviado al webhook
+type WebhookEvent struct {
+	Event     string                `json:"event"`
+	JobID     string                `json:"job_id,omitempty"`
+	Source    string                `json:"source"`
+	Variants  []images.BatchVariant `json:"variants"`
+	Errors    []string              `json:"errors"`
+	Timestamp time.Time             `json:"timestamp"`
+}
+
+// webhookStatusError es una respuesta del webhook con un código distinto de 2xx
+type webhookStatusError int
+
+func (e webhookStatusError) Error() string { return fmt.Sprintf("status %d", int(e)) }
+
+// WebhookNotifier envía eventos firmados con HMAC-SHA256 a una URL configurada, con reintentos
+type WebhookNotifier struct {
+	url         string
+	secret      string
+	maxAttempts int
+	client      *http.Client
+}
+
+// NewWebhookNotifier crea un notificador; retorna nil si no hay URL configurada
+func NewWebhookNotifier(url, secret string, maxAttempts int) *WebhookNotifier {
+	if url == "" {
+		return nil
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &WebhookNotifier{
+		url:         url,
+		secret:      secret,
+		maxAttempts: maxAttempts,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// NotifyJob envía el resultado de un trabajo terminado
+func (wn *WebhookNotifier) NotifyJob(job *Job) {
+	if wn == nil || job == nil {
+		return
+	}
+	event := &WebhookEvent{
+		Event:  EventJobCompleted,
+		JobID:  job.ID,
+		Source: job.Request.URL,
+	}
+	if job.Status == StatusFailed {
+		event.Event = EventJobFailed
+		event.Errors = []string{job.Error}
+	}
+	if job.Result != nil {
+		event.Source = job.Result.Source
+		event.Variants = job.Result.Variants
+	}
+	wn.Notify(event)
+}
+
+// NotifyBatch envía el resultado de una generación batch síncrona
+func (wn *WebhookNotifier) NotifyBatch(req *images.BatchRequest, result *images.BatchResult, err error) {
+	if wn == nil {
+		return
+	}
+	event := &WebhookEvent{
+		Event:  EventBatchCompleted,
+		Source: req.URL,
+	}
+	if err != nil {
+		event.Event = EventBatchFailed
+		event.Errors = []string{err.Error()}
+	}
+	if result != nil {
+		event.Source = result.Source
+		event.Variants = result.Variants
+	}
+	wn.Notify(event)
+}
+
+// Notify envía el evento en segundo plano, reintentando con backoff exponencial los errores
+// de red y las respuestas 5xx, 408 y 429. Un notificador nil no hace nada.
+func (wn *WebhookNotifier) Notify(event *WebhookEvent) {
+	if wn == nil {
+		return
+	}
+	if event.Variants == nil {
+		event.Variants = []images.BatchVariant{}
+	}
+	if event.Errors == nil {
+		event.Errors = []string{}
+	}
+	event.Timestamp = time.Now().UTC()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("Warning: failed to encode webhook event: %v\n", err)
+		return
+	}
+
+	go func() {
+		for attempt := 1; attempt <= wn.maxAttempts; attempt++ {
+			err := wn.send(body)
+			if err == nil {
+				return
+			}
+			if attempt == wn.maxAttempts || !retryable(err) {
+				fmt.Printf("Warning: webhook %s delivery failed after %d attempts: %v\n", event.Event, attempt, err)
+				return
+			}
+			time.Sleep(time.Duration(1<<(attempt-1)) * time.Second)
+		}
+	}()
+}
+
+// send realiza un intento de entrega del payload
+func (wn *WebhookNotifier) send(body []byte) error {
+	req, err := http.NewRequest("POST", wn.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "serve-img-optimized-webhook")
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	if wn.secret != "" {
+		req.Header.Set("X-Webhook-Signature", "sha256="+wn.sign(timestamp, body))
+	}
+
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return webhookStatusError(resp.StatusCode)
+	}
+	return nil
+}
+
+// retryable indica si una entrega fallida puede tener éxito al reintentar: el resto de
+// las respuestas 4xx indican un problema del payload o de la configuración del receptor
+func retryable(err error) bool {
+	var status webhookStatusError
+	if !errors.As(err, &status) {
+		return true
+	}
+	return status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// sign calcula la firma HMAC-SHA256 de "timestamp.body"
+func (wn *WebhookNotifier) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(wn.secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
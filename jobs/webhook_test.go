@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestWebhookSignature verifica que X-Webhook-Signature sea el HMAC-SHA256 de "timestamp.cuerpo"
+func TestWebhookSignature(t *testing.T) {
+	type delivery struct {
+		timestamp, signature string
+		body                 []byte
+	}
+	deliveries := make(chan delivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{r.Header.Get("X-Webhook-Timestamp"), r.Header.Get("X-Webhook-Signature"), body}
+	}))
+	defer receiver.Close()
+
+	notifier := NewWebhookNotifier(receiver.URL, "webhook-secret", 1)
+	notifier.Notify(&WebhookEvent{Event: EventBatchCompleted, Source: "https://example.com/a.jpg"})
+
+	var got delivery
+	select {
+	case got = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	mac := hmac.New(sha256.New, []byte("webhook-secret"))
+	mac.Write([]byte(got.timestamp + "."))
+	mac.Write(got.body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got.signature != want {
+		t.Errorf("signature = %s, want %s", got.signature, want)
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(got.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != EventBatchCompleted || event.Source != "https://example.com/a.jpg" || event.Variants == nil {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+// TestWebhookRetryable verifica que sólo se reintenten los errores de red, 5xx, 408 y 429
+func TestWebhookRetryable(t *testing.T) {
+	var status int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	notifier := NewWebhookNotifier(receiver.URL, "", 1)
+
+	tests := map[int]bool{
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusNotFound:            false,
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusServiceUnavailable:  true,
+	}
+	for code, want := range tests {
+		status = code
+		err := notifier.send([]byte("{}"))
+		if err == nil {
+			t.Fatalf("status %d: send succeeded", code)
+		}
+		if got := retryable(err); got != want {
+			t.Errorf("status %d: retryable = %v, want %v", code, got, want)
+		}
+	}
+
+	// Un receptor caído se reintenta
+	receiver.Close()
+	if err := notifier.send([]byte("{}")); err == nil || !retryable(err) {
+		t.Errorf("network error = %v, want a retryable error", err)
+	}
+}
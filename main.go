@@ -15,13 +15,20 @@ func main() {
 		fmt.Println("Advertencia: No se pudo cargar el archivo .env. Se usarán las variables de entorno del sistema si existen.")
 	}
 
-	r := routes.NewRoutes()
+	r, err := routes.NewRoutes()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "4441"
 	}
 	fmt.Printf("Server is running on port %s\n", port)
-	http.ListenAndServe(":"+port, r)
+	if err := http.ListenAndServe(":"+port, r); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
 }
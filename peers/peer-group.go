@@ -0,0 +1,388 @@
+package peers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loxzer01/serve-img-optimized/cache"
+)
+
+// Headers del intercambio entre réplicas
+const (
+	RequestHeader   = "X-Peer-Request"   // marca una petición reenviada por otra réplica; contiene su URL
+	SignatureHeader = "X-Peer-Signature" // "<unix>.<hmac>" de la petición reenviada, firmada con el secreto del grupo
+	MetaHeader      = "X-Peer-Meta"      // metadatos de la variante (JSON en base64) en la respuesta del dueño
+)
+
+// maxSignatureAge es la antigüedad máxima (o el adelanto, por diferencias de reloj)
+// aceptada en la firma de una petición entre réplicas
+const maxSignatureAge = 5 * time.Minute
+
+// PeerGroup reparte las variantes entre las réplicas: cada clave de caché tiene un dueño
+// elegido por hashing consistente, y las demás réplicas le piden la variante en lugar de
+// descargar y procesar el original por su cuenta (al estilo de groupcache).
+type PeerGroup struct {
+	self   string
+	secret []byte // secreto compartido con el que se firman las peticiones entre réplicas
+	client *http.Client
+
+	mu      sync.RWMutex
+	members []string
+	ring    *Ring
+
+	statsMu  sync.Mutex
+	fetches  int64
+	failures int64
+}
+
+// PeerStats resume el estado del grupo
+type PeerStats struct {
+	Self     string   `json:"self"`
+	Members  []string `json:"members"`
+	Fetches  int64    `json:"fetches"`  // variantes obtenidas de su dueño
+	Failures int64    `json:"failures"` // pedidos fallidos al dueño, resueltos localmente
+}
+
+// PurgeResult es la respuesta de una réplica a una purga reenviada
+type PurgeResult struct {
+	Purged int    `json:"purged"`
+	Error  string `json:"error,omitempty"`
+}
+
+// NewPeerGroup crea un grupo con la URL base de esta réplica y las de las demás.
+// secret firma las peticiones entre réplicas y debe ser el mismo en todo el grupo.
+func NewPeerGroup(self, secret string, members []string) *PeerGroup {
+	group := &PeerGroup{
+		self:   normalizePeer(self),
+		secret: []byte(secret),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+	group.SetMembers(members)
+	return group
+}
+
+// NewDNSPeerGroup crea un grupo cuyos miembros se obtienen resolviendo un nombre DNS
+// (por ejemplo, un servicio headless de Kubernetes) y se actualizan cada refresh
+func NewDNSPeerGroup(self, secret, host, scheme, port string, refresh time.Duration) (*PeerGroup, error) {
+	if refresh <= 0 {
+		return nil, fmt.Errorf("invalid peers refresh interval: %v", refresh)
+	}
+	resolve := func() ([]string, error) {
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			return nil, err
+		}
+		members := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			members = append(members, scheme+"://"+net.JoinHostPort(addr, port))
+		}
+		return members, nil
+	}
+
+	members, err := resolve()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve peers from %s: %v", host, err)
+	}
+	self, err = resolveSelf(self, port, members)
+	if err != nil {
+		return nil, err
+	}
+
+	group := NewPeerGroup(self, secret, members)
+	go func() {
+		for range time.Tick(refresh) {
+			members, err := resolve()
+			if err != nil {
+				fmt.Printf("Warning: failed to refresh peers from %s: %v\n", host, err)
+				continue
+			}
+			group.SetMembers(members)
+		}
+	}()
+	return group, nil
+}
+
+// resolveSelf expresa la URL de esta réplica como las resueltas por DNS (scheme://ip:puerto).
+// Si PEER_SELF usa un nombre de host, la réplica aparecería dos veces en el grupo (una con
+// el nombre y otra con su IP) y se reenviaría peticiones a sí misma.
+func resolveSelf(self, port string, members []string) (string, error) {
+	self = normalizePeer(self)
+	parsedSelf, err := url.Parse(self)
+	if err != nil || parsedSelf.Hostname() == "" {
+		return "", fmt.Errorf("invalid peer URL: %s", self)
+	}
+	if parsedSelf.Port() != "" {
+		port = parsedSelf.Port()
+	}
+
+	candidates := []string{parsedSelf.Hostname()}
+	if net.ParseIP(parsedSelf.Hostname()) == nil {
+		if candidates, err = net.LookupHost(parsedSelf.Hostname()); err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %v", parsedSelf.Hostname(), err)
+		}
+	}
+	for _, candidate := range candidates {
+		resolved := parsedSelf.Scheme + "://" + net.JoinHostPort(candidate, port)
+		for _, member := range members {
+			if normalizePeer(member) == resolved {
+				return resolved, nil
+			}
+		}
+	}
+
+	// La réplica puede no figurar todavía en el DNS (por ejemplo, si aún no está lista);
+	// entrará al grupo en una actualización posterior
+	resolved := parsedSelf.Scheme + "://" + net.JoinHostPort(candidates[0], port)
+	fmt.Printf("Warning: peer %s is not among the resolved peers %s\n", resolved, strings.Join(members, ", "))
+	return resolved, nil
+}
+
+// SetMembers reemplaza los miembros del grupo; esta réplica siempre forma parte de él
+func (pg *PeerGroup) SetMembers(members []string) {
+	seen := map[string]bool{pg.self: true}
+	normalized := []string{pg.self}
+	for _, member := range members {
+		member = normalizePeer(member)
+		if member != "" && !seen[member] {
+			seen[member] = true
+			normalized = append(normalized, member)
+		}
+	}
+	sort.Strings(normalized)
+
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	if strings.Join(normalized, ",") == strings.Join(pg.members, ",") {
+		return
+	}
+	pg.members = normalized
+	pg.ring = NewRing(normalized)
+	fmt.Printf("Peer group: %s\n", strings.Join(normalized, ", "))
+}
+
+// Owner retorna la réplica dueña de una clave e indica si es esta misma
+func (pg *PeerGroup) Owner(key string) (string, bool) {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	owner := pg.ring.Owner(key)
+	return owner, owner == pg.self
+}
+
+// Fetch pide una variante a su dueño repitiendo la petición original (ruta y query).
+// header aporta los headers a reenviar, como Authorization.
+func (pg *PeerGroup) Fetch(owner, requestURI string, header http.Header) ([]byte, *cache.EntryMeta, error) {
+	data, meta, err := pg.fetch(owner, requestURI, header)
+
+	pg.statsMu.Lock()
+	if err != nil {
+		pg.failures++
+	} else {
+		pg.fetches++
+	}
+	pg.statsMu.Unlock()
+
+	return data, meta, err
+}
+
+// fetch realiza el pedido al dueño
+func (pg *PeerGroup) fetch(owner, requestURI string, header http.Header) ([]byte, *cache.EntryMeta, error) {
+	req, err := pg.newRequest("GET", owner, requestURI, header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := pg.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("peer %s returned status %d", owner, resp.StatusCode)
+	}
+	meta, err := DecodeMeta(resp.Header.Get(MetaHeader))
+	if err != nil {
+		return nil, nil, fmt.Errorf("peer %s returned invalid metadata: %v", owner, err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, meta, nil
+}
+
+// Purge reenvía una purga (DELETE con la misma ruta y query) a las demás réplicas en
+// paralelo, para que alcance también sus copias y las variantes de las que son dueñas.
+// Retorna la respuesta de cada réplica.
+func (pg *PeerGroup) Purge(requestURI string, header http.Header) map[string]*PurgeResult {
+	pg.mu.RLock()
+	members := append([]string(nil), pg.members...)
+	pg.mu.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]*PurgeResult, len(members))
+	for _, member := range members {
+		if member == pg.self {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := pg.purge(member, requestURI, header)
+			if err != nil {
+				result = &PurgeResult{Error: err.Error()}
+			}
+			mu.Lock()
+			results[member] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// purge reenvía la purga a una réplica
+func (pg *PeerGroup) purge(member, requestURI string, header http.Header) (*PurgeResult, error) {
+	req, err := pg.newRequest("DELETE", member, requestURI, header)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := pg.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s returned status %d", member, resp.StatusCode)
+	}
+	var result PurgeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("peer %s returned an invalid response: %v", member, err)
+	}
+	return &result, nil
+}
+
+// newRequest crea una petición firmada hacia otra réplica, reenviando el Authorization original
+func (pg *PeerGroup) newRequest(method, member, requestURI string, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequest(method, member+requestURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth := header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	req.Header.Set(RequestHeader, pg.self)
+	req.Header.Set(SignatureHeader, pg.sign(method, requestURI, pg.self, time.Now()))
+	return req, nil
+}
+
+// sign calcula la firma de una petición entre réplicas: HMAC-SHA256 del método, la ruta con
+// su query, la réplica que la envía y el instante de envío
+func (pg *PeerGroup) sign(method, requestURI, sender string, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, pg.secret)
+	mac.Write([]byte(method + "\n" + requestURI + "\n" + sender + "\n" + timestamp))
+	return timestamp + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify indica si la petición viene de otra réplica del grupo: su firma debe coincidir
+// y no tener más de maxSignatureAge
+func (pg *PeerGroup) Verify(r *http.Request) bool {
+	sender := r.Header.Get(RequestHeader)
+	timestamp, _, found := strings.Cut(r.Header.Get(SignatureHeader), ".")
+	if sender == "" || !found {
+		return false
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	at := time.Unix(unix, 0)
+	if age := time.Since(at); age > maxSignatureAge || age < -maxSignatureAge {
+		return false
+	}
+	expected := pg.sign(r.Method, r.URL.RequestURI(), sender, at)
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get(SignatureHeader)))
+}
+
+// Stats retorna el estado actual del grupo
+func (pg *PeerGroup) Stats() *PeerStats {
+	pg.mu.RLock()
+	members := append([]string(nil), pg.members...)
+	pg.mu.RUnlock()
+
+	pg.statsMu.Lock()
+	defer pg.statsMu.Unlock()
+	return &PeerStats{
+		Self:     pg.self,
+		Members:  members,
+		Fetches:  pg.fetches,
+		Failures: pg.failures,
+	}
+}
+
+// Middleware elimina los headers entre réplicas de las peticiones que no están firmadas por
+// el grupo, de modo que un cliente no pueda hacerse pasar por una réplica. Con el grupo
+// deshabilitado (nil) los elimina siempre.
+func (pg *PeerGroup) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(RequestHeader) != "" && (pg == nil || !pg.Verify(r)) {
+			r.Header.Del(RequestHeader)
+			r.Header.Del(SignatureHeader)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsPeerRequest indica si la petición fue reenviada por otra réplica; esas peticiones se
+// resuelven localmente para no reenviarse en cadena. Sólo es confiable detrás de Middleware.
+func IsPeerRequest(r *http.Request) bool {
+	return r.Header.Get(RequestHeader) != ""
+}
+
+// EncodeMeta serializa los metadatos de una variante para el header MetaHeader
+func EncodeMeta(meta *cache.EntryMeta) string {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// DecodeMeta interpreta el header MetaHeader
+func DecodeMeta(value string) (*cache.EntryMeta, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing %s header", MetaHeader)
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var meta cache.EntryMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// normalizePeer elimina espacios y la barra final de la URL base de una réplica
+func normalizePeer(peer string) string {
+	return strings.TrimRight(strings.TrimSpace(peer), "/")
+}
@@ -0,0 +1,131 @@
+package peers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestVerify verifica que sólo se acepten peticiones firmadas con el secreto del grupo y recientes
+func TestVerify(t *testing.T) {
+	group := NewPeerGroup("http://10.0.0.1:4441", "secret", []string{"http://10.0.0.2:4441"})
+	other := NewPeerGroup("http://10.0.0.2:4441", "secret", nil)
+	intruder := NewPeerGroup("http://10.0.0.2:4441", "wrong", nil)
+
+	signed, err := other.newRequest("GET", "http://10.0.0.1:4441", "/api/image/w_400/a.jpg?origin=x", http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !group.Verify(signed) {
+		t.Error("request signed by a member was rejected")
+	}
+
+	forged, _ := intruder.newRequest("GET", "http://10.0.0.1:4441", "/api/image/w_400/a.jpg?origin=x", http.Header{})
+	if group.Verify(forged) {
+		t.Error("request signed with another secret was accepted")
+	}
+
+	unsigned := httptest.NewRequest("GET", "/api/image/w_400/a.jpg", nil)
+	unsigned.Header.Set(RequestHeader, "http://10.0.0.2:4441")
+	if group.Verify(unsigned) {
+		t.Error("unsigned request was accepted")
+	}
+
+	// La firma cubre la ruta: no puede reutilizarse para otra variante
+	tampered := signed.Clone(signed.Context())
+	tampered.URL.RawQuery = "origin=y"
+	if group.Verify(tampered) {
+		t.Error("signature was accepted for another URL")
+	}
+
+	expired := signed.Clone(signed.Context())
+	expired.Header.Set(SignatureHeader, other.sign("GET", signed.URL.RequestURI(), other.self, time.Now().Add(-2*maxSignatureAge)))
+	if group.Verify(expired) {
+		t.Error("expired signature was accepted")
+	}
+}
+
+// TestMiddleware verifica que los headers entre réplicas se eliminen de las peticiones no firmadas
+func TestMiddleware(t *testing.T) {
+	group := NewPeerGroup("http://10.0.0.1:4441", "secret", nil)
+	var gotPeer bool
+	handler := group.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPeer = IsPeerRequest(r)
+	}))
+
+	spoofed := httptest.NewRequest("GET", "/api/image/w_400/a.jpg", nil)
+	spoofed.Header.Set(RequestHeader, "http://10.0.0.2:4441")
+	handler.ServeHTTP(httptest.NewRecorder(), spoofed)
+	if gotPeer {
+		t.Error("unsigned request was treated as a peer request")
+	}
+
+	signed, _ := NewPeerGroup("http://10.0.0.2:4441", "secret", nil).newRequest("GET", "", "/api/image/w_400/a.jpg", http.Header{})
+	handler.ServeHTTP(httptest.NewRecorder(), signed)
+	if !gotPeer {
+		t.Error("signed request was not treated as a peer request")
+	}
+
+	// Sin grupo ninguna petición es de una réplica
+	var disabled *PeerGroup
+	disabled.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPeer = IsPeerRequest(r)
+	})).ServeHTTP(httptest.NewRecorder(), signed)
+	if gotPeer {
+		t.Error("peer request accepted with the group disabled")
+	}
+}
+
+// TestPurge verifica que la purga se reenvíe firmada a las demás réplicas y reporte cada respuesta
+func TestPurge(t *testing.T) {
+	var group *PeerGroup
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || !group.Verify(r) || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]int{"purged": 3})
+	}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	group = NewPeerGroup("http://127.0.0.1:1", "secret", []string{healthy.URL, failing.URL})
+	results := group.Purge("/api/cache?tag=product-42", http.Header{"Authorization": {"Bearer token"}})
+
+	if len(results) != 2 {
+		t.Fatalf("results = %v, want one per peer", results)
+	}
+	if result := results[healthy.URL]; result.Purged != 3 || result.Error != "" {
+		t.Errorf("healthy peer result = %+v, want 3 purged", result)
+	}
+	if result := results[failing.URL]; result.Error == "" {
+		t.Errorf("failing peer result = %+v, want an error", result)
+	}
+}
+
+// TestResolveSelf verifica que PEER_SELF se exprese como los miembros resueltos por DNS
+func TestResolveSelf(t *testing.T) {
+	members := []string{"http://127.0.0.1:4441", "http://10.0.0.2:4441"}
+
+	self, err := resolveSelf("http://localhost:4441/", "4441", members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if self != "http://127.0.0.1:4441" {
+		t.Errorf("self = %s, want http://127.0.0.1:4441", self)
+	}
+
+	// Sin puerto se usa el de los miembros
+	if self, _ := resolveSelf("http://10.0.0.2", "4441", members); self != "http://10.0.0.2:4441" {
+		t.Errorf("self = %s, want http://10.0.0.2:4441", self)
+	}
+
+	if _, err := resolveSelf("10.0.0.2:4441", "4441", members); err == nil {
+		t.Error("expected an error for a peer URL without scheme")
+	}
+}
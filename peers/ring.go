@@ -0,0 +1,46 @@
+package peers
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// ringReplicas es el número de puntos virtuales de cada nodo en el anillo;
+// más puntos reparten las claves de forma más pareja entre los nodos
+const ringReplicas = 100
+
+// Ring asigna claves a nodos con hashing consistente: al agregar o quitar un nodo
+// sólo cambian de dueño las claves de ese nodo, no las de todo el grupo
+type Ring struct {
+	hashes []uint32          // puntos del anillo ordenados
+	nodes  map[uint32]string // nodo de cada punto
+}
+
+// NewRing crea un anillo con los nodos indicados
+func NewRing(nodes []string) *Ring {
+	ring := &Ring{nodes: make(map[uint32]string, len(nodes)*ringReplicas)}
+	for _, node := range nodes {
+		for i := 0; i < ringReplicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node))
+			ring.hashes = append(ring.hashes, hash)
+			ring.nodes[hash] = node
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool { return ring.hashes[i] < ring.hashes[j] })
+	return ring
+}
+
+// Owner retorna el nodo dueño de una clave: el primer punto del anillo igual o
+// posterior al hash de la clave. Retorna "" si el anillo está vacío.
+func (r *Ring) Owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/loxzer01/serve-img-optimized/images"
+	"github.com/loxzer01/serve-img-optimized/jobs"
+)
+
+// maxBatchBodySize limita el tamaño del JSON de una petición batch
+const maxBatchBodySize = 1 << 20
+
+// BatchHandler genera varias variantes de una imagen y retorna su manifiesto.
+// El resultado también se notifica al webhook, si está configurado.
+func BatchHandler(optimizer *images.ImageOptimizer, notifier *jobs.WebhookNotifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req images.BatchRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBodySize)).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid batch request: %v", err))
+			return
+		}
+		if len(req.Tags) > 0 && !isAuthenticated(r) {
+			respondWithError(w, http.StatusForbidden, errTagsRequireAuth)
+			return
+		}
+
+		result, err := optimizer.GenerateVariants(&req)
+		notifier.NotifyBatch(&req, result, err)
+		if err != nil {
+			respondWithError(w, errorStatus(err), fmt.Sprintf("Error generating variants: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+	}
+}
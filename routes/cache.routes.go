@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/loxzer01/serve-img-optimized/images"
+	"github.com/loxzer01/serve-img-optimized/peers"
+)
+
+// purgeModes son los parámetros aceptados por DELETE /api/cache; se debe indicar exactamente uno
+var purgeModes = []string{"url", "prefix", "host", "variant", "tag", "all"}
+
+// PurgeCacheHandler elimina entradas del caché
+// Formato: DELETE /api/cache?url=@products/a.jpg | ?prefix=https://cdn.example.com/products/ |
+// ?host=cdn.example.com | ?variant=w_400,q_90/@products/a.jpg&origin=dominio.com |
+// ?tag=product-42,tenant-acme | ?all=true
+// Requiere API_TOKEN: sin token configurado la purga no está disponible.
+// Con un grupo de réplicas la purga se reenvía a las demás, y purged suma las de todas.
+func PurgeCacheHandler(optimizer *images.ImageOptimizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Purgar vacía el caché de todas las réplicas: no se acepta de clientes anónimos
+		if !isAuthenticated(r) {
+			respondWithError(w, http.StatusForbidden, "Purging the cache requires authentication with API_TOKEN")
+			return
+		}
+
+		query := r.URL.Query()
+
+		mode := ""
+		for _, candidate := range purgeModes {
+			if query.Get(candidate) == "" {
+				continue
+			}
+			if mode != "" {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Only one of %v can be specified", purgeModes))
+				return
+			}
+			mode = candidate
+		}
+
+		var purged int
+		var err error
+		switch mode {
+		case "url":
+			purged, err = optimizer.PurgeSource(query.Get("url"))
+		case "prefix":
+			purged, err = optimizer.PurgePrefix(query.Get("prefix"))
+		case "host":
+			purged = optimizer.PurgeHost(query.Get("host"))
+		case "variant":
+			purged, err = optimizer.PurgeVariant(query.Get("variant"), query.Get("origin"))
+		case "tag":
+			purged, err = optimizer.PurgeTags(strings.Split(query.Get("tag"), ","))
+		case "all":
+			if query.Get("all") != "true" {
+				respondWithError(w, http.StatusBadRequest, "all must be true to flush the cache")
+				return
+			}
+			purged = optimizer.FlushCache()
+		default:
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("One of %v is required", purgeModes))
+			return
+		}
+		if err != nil {
+			respondWithError(w, errorStatus(err), fmt.Sprintf("Error purging cache: %v", err))
+			return
+		}
+
+		fmt.Printf("Cache purge (%s=%s): %d entries removed\n", mode, query.Get(mode), purged)
+
+		response := map[string]interface{}{}
+		if optimizer.Peers != nil && !peers.IsPeerRequest(r) {
+			// Cada réplica guarda las variantes de las que es dueña y las que obtuvo de otras
+			results := optimizer.Peers.Purge(r.URL.RequestURI(), r.Header)
+			for member, result := range results {
+				if result.Error != "" {
+					fmt.Printf("Warning: failed to purge cache on peer %s: %s\n", member, result.Error)
+				}
+				purged += result.Purged
+			}
+			response["peers"] = results
+		}
+		response["purged"] = purged
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	}
+}
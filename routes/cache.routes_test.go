@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/loxzer01/serve-img-optimized/cache"
+	"github.com/loxzer01/serve-img-optimized/images"
+)
+
+// purgeRequest envía DELETE /api/cache con la query indicada a través de authMiddleware
+func purgeRequest(optimizer *images.ImageOptimizer, query, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("DELETE", "/api/cache?"+query, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	authMiddleware(PurgeCacheHandler(optimizer)).ServeHTTP(w, r)
+	return w
+}
+
+// TestPurgeCacheHandlerRequiresAuth verifica que las purgas anónimas se rechacen, con o sin API_TOKEN
+func TestPurgeCacheHandlerRequiresAuth(t *testing.T) {
+	optimizer := newTestOptimizer(t)
+
+	t.Setenv("API_TOKEN", "")
+	if w := purgeRequest(optimizer, "all=true", ""); w.Code != http.StatusForbidden {
+		t.Errorf("anonymous purge without API_TOKEN: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	t.Setenv("API_TOKEN", "secret-token")
+	if w := purgeRequest(optimizer, "all=true", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("purge without a token: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := purgeRequest(optimizer, "all=true", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("purge with a wrong token: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := purgeRequest(optimizer, "all=true", "secret-token"); w.Code != http.StatusOK {
+		t.Errorf("authenticated purge: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+// TestPurgeCacheHandler verifica la validación de los modos de purga y el conteo de entradas eliminadas
+func TestPurgeCacheHandler(t *testing.T) {
+	t.Setenv("API_TOKEN", "secret-token")
+	optimizer := newTestOptimizer(t)
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"", http.StatusBadRequest},
+		{"url=example.com/a.jpg&host=example.com", http.StatusBadRequest},
+		{"all=yes", http.StatusBadRequest},
+		{"variant=w_0/example.com/a.jpg", http.StatusBadRequest},
+		{"tag=Not%20A%20Tag", http.StatusBadRequest},
+		{"url=example.com/a.jpg", http.StatusOK},
+		{"prefix=https://example.com/products/", http.StatusOK},
+		{"host=example.com", http.StatusOK},
+		{"variant=w_400/example.com/a.jpg", http.StatusOK},
+		{"tag=product-42", http.StatusOK},
+		{"all=true", http.StatusOK},
+	}
+	for _, test := range tests {
+		w := purgeRequest(optimizer, test.query, "secret-token")
+		if w.Code != test.status {
+			t.Errorf("DELETE /api/cache?%s: status = %d, want %d: %s", test.query, w.Code, test.status, w.Body.String())
+		}
+	}
+}
+
+// TestPurgeCacheHandlerCountsEntries verifica que la respuesta informe las entradas eliminadas
+func TestPurgeCacheHandlerCountsEntries(t *testing.T) {
+	t.Setenv("API_TOKEN", "secret-token")
+	cacheManager := cache.NewCacheManager(t.TempDir(), time.Hour, 10)
+	optimizer := images.NewImageOptimizer(cacheManager, &images.Config{}, nil)
+
+	for i, tags := range [][]string{{"product-42"}, {"product-42", "tenant-acme"}, {"tenant-acme"}} {
+		cacheKey := cacheManager.GenerateCacheKey(fmt.Sprintf("v2?src=%d", i), "jpeg")
+		if err := cacheManager.SaveToCache(cacheKey, []byte("data"), time.Hour, &cache.EntryMeta{Tags: tags}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := purgeRequest(optimizer, "tag=product-42", "secret-token")
+	var response struct {
+		Purged int `json:"purged"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || response.Purged != 2 {
+		t.Errorf("status = %d, purged = %d; want 200 and 2", w.Code, response.Purged)
+	}
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -14,9 +15,12 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/loxzer01/serve-img-optimized/cache"
 	"github.com/loxzer01/serve-img-optimized/images"
+	"github.com/loxzer01/serve-img-optimized/jobs"
+	"github.com/loxzer01/serve-img-optimized/peers"
 )
 
-func NewRoutes() *chi.Mux {
+// NewRoutes configura el router y todas sus dependencias; retorna un error si alguna falla
+func NewRoutes() (*chi.Mux, error) {
 	r := chi.NewRouter()
 
 	// CORS middleware
@@ -37,12 +41,42 @@ func NewRoutes() *chi.Mux {
 	// Configurar cache manager
 	cacheManager, err := setupCacheManager()
 	if err != nil {
-		fmt.Errorf("failed to setup cache manager: %v", err)
-		return nil
+		return nil, fmt.Errorf("failed to setup cache manager: %w", err)
+	}
+
+	// Cargar configuración de orígenes
+	config, err := images.LoadConfig(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Configurar fuentes de imágenes originales
+	sources, err := setupSources(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup image sources: %w", err)
 	}
 
 	// Crear optimizador de imágenes
-	imageOptimizer := images.NewImageOptimizer(cacheManager)
+	imageOptimizer := images.NewImageOptimizer(cacheManager, config, sources)
+
+	// Grupo de réplicas que se reparten las variantes por hashing consistente
+	peerGroup, err := setupPeers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup peer group: %w", err)
+	}
+	imageOptimizer.Peers = peerGroup
+
+	// Sólo las peticiones firmadas por el grupo se tratan como reenviadas por otra réplica
+	r.Use(peerGroup.Middleware)
+
+	// Notificaciones webhook al terminar trabajos y generaciones batch
+	notifier := setupWebhook()
+
+	// Configurar cola de trabajos asíncronos
+	jobQueue, err := setupJobQueue(imageOptimizer, notifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup job queue: %w", err)
+	}
 
 	// Rutas de la API
 	r.Route("/api", func(r chi.Router) {
@@ -53,12 +87,29 @@ func NewRoutes() *chi.Mux {
 		// Formato: /api/image/w_400,q_90/example.com/image.jpg?origin="domain.com"
 		r.Get("/image/*", OptimizeImageHandler(imageOptimizer))
 
+		// Optimización de imágenes subidas directamente (bytes crudos o multipart)
+		// Formato: POST /api/image?transform=w_400,q_90
+		r.Post("/image", UploadImageHandler(imageOptimizer, maxUploadSize()))
+
+		// Generación de varias variantes con una sola descarga
+		r.Post("/batch", BatchHandler(imageOptimizer, notifier))
+
+		// Trabajos asíncronos para transformaciones pesadas
+		r.Post("/jobs", SubmitJobHandler(jobQueue))
+		r.Get("/jobs/{id}", JobStatusHandler(jobQueue))
+
+		// srcset y <picture> listos para usar
+		r.Get("/srcset", SrcsetHandler(imageOptimizer))
+
 		// Información de imagen
 		r.Get("/info", ImageInfoHandler(imageOptimizer))
 
 		// Estadísticas de caché
 		r.Get("/cache/stats", CacheStatsHandler(imageOptimizer))
 
+		// Invalidación del caché por imagen, prefijo, host, variante o completa
+		r.Delete("/cache", PurgeCacheHandler(imageOptimizer))
+
 		// Health check
 		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
@@ -76,7 +127,18 @@ func NewRoutes() *chi.Mux {
 	// Formato: /w_400,q_90/url?origin="dominio.com"
 	// r.HandleFunc("/*", OptimizeImageHandler(imageOptimizer))
 
-	return r
+	return r, nil
+}
+
+// maxUploadSize obtiene el tamaño máximo de subida en bytes desde MAX_UPLOAD_SIZE (MB)
+func maxUploadSize() int64 {
+	maxUploadSizeMB := 20 // default 20MB
+	if sizeStr := os.Getenv("MAX_UPLOAD_SIZE"); sizeStr != "" {
+		if size, err := strconv.Atoi(sizeStr); err == nil && size > 0 {
+			maxUploadSizeMB = size
+		}
+	}
+	return int64(maxUploadSizeMB) * 1024 * 1024
 }
 
 // setupCacheManager configura el gestor de cache basado en variables de entorno
@@ -100,13 +162,96 @@ func setupCacheManager() (*cache.CacheManager, error) {
 		}
 	}
 
+	// Tier en memoria para las variantes más solicitadas (0 = deshabilitado)
+	memoryCacheSize := 64 // default 64MB
+	if memoryCacheSizeStr := os.Getenv("MEMORY_CACHE_SIZE"); memoryCacheSizeStr != "" {
+		if size, err := strconv.Atoi(memoryCacheSizeStr); err == nil {
+			memoryCacheSize = size
+		}
+	}
+
+	// Política de desalojo cuando se alcanza MAX_CACHE_SIZE
+	evictionPolicy, err := cache.ParseEvictionPolicy(os.Getenv("CACHE_EVICTION_POLICY"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Límites del TTL derivado de Cache-Control/Expires del origen
+	minTTLStr := os.Getenv("CACHE_MIN_TTL")
+	if minTTLStr == "" {
+		minTTLStr = "1min" // default
+	}
+
+	maxTTLStr := os.Getenv("CACHE_MAX_TTL")
+	if maxTTLStr == "" {
+		maxTTLStr = "30d" // default
+	}
+
+	// Ventanas de gracia para servir contenido expirado
+	staleWhileRevalidateStr := os.Getenv("CACHE_STALE_WHILE_REVALIDATE")
+	if staleWhileRevalidateStr == "" {
+		staleWhileRevalidateStr = "1h" // default
+	}
+
+	staleIfErrorStr := os.Getenv("CACHE_STALE_IF_ERROR")
+	if staleIfErrorStr == "" {
+		staleIfErrorStr = "1d" // default
+	}
+
 	// Parsear duración del cache
 	cacheDuration := cache.ParseCacheDuration(cacheDurationStr)
+	minTTL := cache.ParseCacheDuration(minTTLStr)
+	maxTTL := cache.ParseCacheDuration(maxTTLStr)
+	staleWhileRevalidate := cache.ParseCacheDuration(staleWhileRevalidateStr)
+	staleIfError := cache.ParseCacheDuration(staleIfErrorStr)
+
+	fmt.Printf("Cache configuration: Duration=%v, MinTTL=%v, MaxTTL=%v, StaleWhileRevalidate=%v, StaleIfError=%v, Directory=%s, MaxSize=%dMB, MemorySize=%dMB, EvictionPolicy=%s\n",
+		cacheDuration, minTTL, maxTTL, staleWhileRevalidate, staleIfError, cacheDir, maxCacheSize, memoryCacheSize, evictionPolicy)
+
+	// Backend de almacenamiento: disco local (por defecto) o Redis compartido entre réplicas
+	var cacheManager *cache.CacheManager
+	switch backendName := strings.ToLower(os.Getenv("CACHE_BACKEND")); backendName {
+	case "", "disk":
+		cacheManager = cache.NewCacheManager(cacheDir, cacheDuration, maxCacheSize)
+	case "redis":
+		redisURL := os.Getenv("REDIS_URL")
+		if redisURL == "" {
+			return nil, fmt.Errorf("REDIS_URL is required when CACHE_BACKEND=redis")
+		}
+		redisPrefix := os.Getenv("REDIS_KEY_PREFIX")
+		if redisPrefix == "" {
+			redisPrefix = "img:" // default
+		}
+		redisPoolSize := 16 // default
+		if poolSizeStr := os.Getenv("REDIS_POOL_SIZE"); poolSizeStr != "" {
+			if size, err := strconv.Atoi(poolSizeStr); err == nil {
+				redisPoolSize = size
+			}
+		}
+		backend, err := cache.NewRedisBackend(redisURL, redisPrefix, redisPoolSize)
+		if err != nil {
+			return nil, err
+		}
+		cacheManager = cache.NewCacheManagerWithBackend(backend, cacheDuration, maxCacheSize)
 
-	fmt.Printf("Cache configuration: Duration=%v, Directory=%s, MaxSize=%dMB\n",
-		cacheDuration, cacheDir, maxCacheSize)
+		// Redis administra su propia capacidad y el tier en memoria no vería las purgas de otras réplicas
+		if os.Getenv("MAX_CACHE_SIZE") != "" {
+			fmt.Printf("Warning: MAX_CACHE_SIZE is ignored with CACHE_BACKEND=redis; configure maxmemory in Redis instead\n")
+		}
+		if memoryCacheSize > 0 {
+			fmt.Printf("Warning: MEMORY_CACHE_SIZE is ignored with CACHE_BACKEND=redis\n")
+			memoryCacheSize = 0
+		}
+	default:
+		return nil, fmt.Errorf("unknown cache backend: %s", backendName)
+	}
+	fmt.Printf("Cache backend: %s\n", cacheManager.GetCacheDir())
 
-	cacheManager := cache.NewCacheManager(cacheDir, cacheDuration, maxCacheSize)
+	cacheManager.TTLPolicy = cache.NewTTLPolicy(cacheDuration, minTTL, maxTTL)
+	cacheManager.StaleWhileRevalidate = staleWhileRevalidate
+	cacheManager.StaleIfError = staleIfError
+	cacheManager.MemoryTier = cache.NewMemoryTier(memoryCacheSize)
+	cacheManager.SetEvictionPolicy(evictionPolicy)
 
 	// Iniciar limpieza automática en segundo plano
 	startAutomaticCleanup(cacheManager, cacheDuration)
@@ -114,6 +259,156 @@ func setupCacheManager() (*cache.CacheManager, error) {
 	return cacheManager, nil
 }
 
+// setupSources configura las fuentes de imágenes: HTTP por defecto, local y S3 si están definidas
+func setupSources(config *images.Config) (*images.SourceRouter, error) {
+	downloader, err := images.NewImageDownloader(config)
+	if err != nil {
+		return nil, err
+	}
+	sources := images.NewSourceRouter(downloader)
+
+	if localDir := os.Getenv("LOCAL_SOURCE_DIR"); localDir != "" {
+		localSource, err := images.NewLocalSource(localDir)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Local source directory: %s\n", localDir)
+		sources.Register(images.LocalPrefix, localSource)
+	}
+
+	if bucket := os.Getenv("S3_BUCKET"); bucket != "" {
+		s3Source, err := images.NewS3Source(images.S3Config{
+			Bucket:          bucket,
+			Prefix:          os.Getenv("S3_PREFIX"),
+			Region:          os.Getenv("S3_REGION"),
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("S3_SESSION_TOKEN"),
+			PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+			Transport:       config.Transport,
+		})
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("S3 source bucket: %s\n", bucket)
+		sources.Register(images.S3Prefix, s3Source)
+	}
+
+	return sources, nil
+}
+
+// setupJobQueue configura la cola persistente de trabajos y arranca sus workers
+func setupJobQueue(optimizer *images.ImageOptimizer, notifier *jobs.WebhookNotifier) (*jobs.Queue, error) {
+	jobsDir := os.Getenv("JOBS_DIR")
+	if jobsDir == "" {
+		jobsDir = "./cache/jobs" // default
+	}
+
+	workers := 2 // default
+	if workersStr := os.Getenv("JOB_WORKERS"); workersStr != "" {
+		if n, err := strconv.Atoi(workersStr); err == nil {
+			workers = n
+		}
+	}
+
+	maxAttempts := 3 // default
+	if attemptsStr := os.Getenv("JOB_MAX_ATTEMPTS"); attemptsStr != "" {
+		if n, err := strconv.Atoi(attemptsStr); err == nil {
+			maxAttempts = n
+		}
+	}
+
+	retentionStr := os.Getenv("JOB_RETENTION")
+	if retentionStr == "" {
+		retentionStr = "1d" // default
+	}
+	retention := cache.ParseCacheDuration(retentionStr)
+
+	fmt.Printf("Job queue configuration: Directory=%s, Workers=%d, MaxAttempts=%d, Retention=%v\n",
+		jobsDir, workers, maxAttempts, retention)
+
+	queue, err := jobs.NewQueue(jobsDir, optimizer, maxAttempts, retention)
+	if err != nil {
+		return nil, err
+	}
+	queue.Notifier = notifier
+	queue.Start(workers)
+	return queue, nil
+}
+
+// setupWebhook configura el webhook de notificaciones; retorna nil si WEBHOOK_URL no está definida
+func setupWebhook() *jobs.WebhookNotifier {
+	webhookURL := os.Getenv("WEBHOOK_URL")
+	if webhookURL == "" {
+		return nil
+	}
+
+	maxAttempts := 5 // default
+	if attemptsStr := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); attemptsStr != "" {
+		if n, err := strconv.Atoi(attemptsStr); err == nil {
+			maxAttempts = n
+		}
+	}
+
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if secret == "" {
+		fmt.Println("Warning: WEBHOOK_SECRET is not set, webhook payloads will not be signed")
+	}
+
+	fmt.Printf("Webhook configuration: URL=%s, MaxAttempts=%d\n", webhookURL, maxAttempts)
+	return jobs.NewWebhookNotifier(webhookURL, secret, maxAttempts)
+}
+
+// setupPeers configura el grupo de réplicas desde PEERS (lista estática) o PEERS_DNS;
+// retorna nil si no se definió ninguno
+func setupPeers() (*peers.PeerGroup, error) {
+	staticPeers := os.Getenv("PEERS")
+	dnsName := os.Getenv("PEERS_DNS")
+	if staticPeers == "" && dnsName == "" {
+		return nil, nil
+	}
+
+	self := os.Getenv("PEER_SELF")
+	if self == "" {
+		return nil, fmt.Errorf("PEER_SELF is required when PEERS or PEERS_DNS is set")
+	}
+	secret := os.Getenv("PEER_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("PEER_SECRET is required when PEERS or PEERS_DNS is set")
+	}
+
+	if staticPeers != "" {
+		fmt.Printf("Peer configuration: Self=%s, Peers=%s\n", self, staticPeers)
+		return peers.NewPeerGroup(self, secret, strings.Split(staticPeers, ",")), nil
+	}
+
+	port := os.Getenv("PEERS_PORT")
+	if port == "" {
+		port = os.Getenv("PORT")
+	}
+	if port == "" {
+		port = "4441" // default
+	}
+
+	scheme := os.Getenv("PEERS_SCHEME")
+	if scheme == "" {
+		scheme = "http" // default
+	}
+
+	refreshStr := os.Getenv("PEERS_DNS_REFRESH")
+	if refreshStr == "" {
+		refreshStr = "1min" // default
+	}
+	refresh := cache.ParseCacheDuration(refreshStr)
+	if refresh <= 0 {
+		return nil, fmt.Errorf("PEERS_DNS_REFRESH must be positive, got %s", refreshStr)
+	}
+
+	fmt.Printf("Peer configuration: Self=%s, DNS=%s, Port=%s, Refresh=%v\n", self, dnsName, port, refresh)
+	return peers.NewDNSPeerGroup(self, secret, dnsName, scheme, port, refresh)
+}
+
 // startAutomaticCleanup inicia una goroutine que limpia archivos expirados periódicamente
 func startAutomaticCleanup(cacheManager *cache.CacheManager, cacheDuration time.Duration) {
 	// Calcular intervalo de limpieza (cada 1/4 de la duración del cache, mínimo 1 minuto)
@@ -174,10 +469,23 @@ func authMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Token válido, continuar con la solicitud
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authenticatedKey{}, true)))
 	})
 }
 
+// authenticatedKey marca en el contexto las peticiones que presentaron un API_TOKEN válido
+type authenticatedKey struct{}
+
+// isAuthenticated indica si la petición presentó un API_TOKEN válido. Sin API_TOKEN
+// configurado las rutas son anónimas y retorna false.
+func isAuthenticated(r *http.Request) bool {
+	authenticated, _ := r.Context().Value(authenticatedKey{}).(bool)
+	return authenticated
+}
+
+// errTagsRequireAuth es el mensaje para las peticiones anónimas que intentan etiquetar variantes
+const errTagsRequireAuth = "Tags require authentication with API_TOKEN"
+
 // respondWithError envía una respuesta de error en formato JSON
 func respondWithError(w http.ResponseWriter, statusCode int, message string) {
 	w.Header().Set("Content-Type", "application/json")
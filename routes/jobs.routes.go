@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/loxzer01/serve-img-optimized/images"
+	"github.com/loxzer01/serve-img-optimized/jobs"
+)
+
+// SubmitJobHandler encola un trabajo de generación de variantes y retorna su ID
+func SubmitJobHandler(queue *jobs.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req images.BatchRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBodySize)).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid job request: %v", err))
+			return
+		}
+		if len(req.Tags) > 0 && !isAuthenticated(r) {
+			respondWithError(w, http.StatusForbidden, errTagsRequireAuth)
+			return
+		}
+
+		job, err := queue.Submit(&req)
+		if err != nil {
+			status := errorStatus(err)
+			if errors.Is(err, jobs.ErrQueueFull) {
+				status = http.StatusServiceUnavailable
+			}
+			respondWithError(w, status, fmt.Sprintf("Error submitting job: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/jobs/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// JobStatusHandler retorna el estado de un trabajo y, si terminó, el manifiesto de variantes
+func JobStatusHandler(queue *jobs.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := queue.Get(chi.URLParam(r, "id"))
+		if !ok {
+			respondWithError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(job)
+	}
+}
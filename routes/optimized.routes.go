@@ -1,34 +1,114 @@
 package routes
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 
 	"github.com/loxzer01/serve-img-optimized/images"
+	"github.com/loxzer01/serve-img-optimized/peers"
 )
 
 // OptimizeImageHandler maneja las peticiones de optimización de imágenes
 func OptimizeImageHandler(optimizer *images.ImageOptimizer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Las etiquetas permiten purgar grupos de variantes: no se aceptan de clientes anónimos
+		if r.URL.Query().Get("tags") != "" && !isAuthenticated(r) {
+			http.Error(w, errTagsRequireAuth, http.StatusForbidden)
+			return
+		}
+
 		// Procesar imagen usando el optimizador
-		processedData, contentType, err := optimizer.OptimizeImage(r)
+		processedData, meta, err := optimizer.OptimizeImage(r)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error processing image: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Error processing image: %v", err), errorStatus(err))
 			return
 		}
 
-		// Configurar headers de respuesta
-		w.Header().Set("Content-Type", contentType)
-		w.Header().Set("Cache-Control", "public, max-age=31536000")
+		// Configurar headers de respuesta a partir de los metadatos de la variante
+		w.Header().Set("Content-Type", meta.ContentType)
+		w.Header().Set("ETag", meta.ETag)
+		if meta.ServedBy != "" {
+			w.Header().Set("X-Origin-Served-By", meta.ServedBy)
+		}
+		w.Header().Set("Cache-Control", optimizer.CacheControl(meta))
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		if peers.IsPeerRequest(r) {
+			// La réplica que reenvió la petición necesita los metadatos para cachear la variante
+			w.Header().Set(peers.MetaHeader, peers.EncodeMeta(meta))
+		}
+
+		// Escribir la imagen procesada; ServeContent responde 304 a If-None-Match / If-Modified-Since
+		http.ServeContent(w, r, "", meta.CreatedAt, bytes.NewReader(processedData))
+	}
+}
+
+// UploadImageHandler optimiza una imagen enviada en el cuerpo de la petición.
+// Acepta bytes crudos o multipart/form-data (campo "image") y las transformaciones
+// en el parámetro "transform" (query o campo del formulario), por ejemplo w_400,q_90.
+func UploadImageHandler(optimizer *images.ImageOptimizer, maxUploadSize int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+		imageData, err := readUploadedImage(r, maxUploadSize)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, fmt.Sprintf("Image exceeds the maximum upload size of %d bytes", maxUploadSize), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Error reading uploaded image: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		transformations := r.URL.Query().Get("transform")
+		if transformations == "" && r.MultipartForm != nil {
+			transformations = r.FormValue("transform")
+		}
 
-		// Escribir la imagen procesada
+		processedData, contentType, err := optimizer.OptimizeUpload(imageData, transformations)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error processing image: %v", err), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-store")
 		w.Write(processedData)
 	}
 }
 
+// readUploadedImage obtiene los bytes de la imagen desde multipart/form-data o del cuerpo crudo
+func readUploadedImage(r *http.Request, maxUploadSize int64) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			return nil, fmt.Errorf("empty request body")
+		}
+		return data, nil
+	}
+
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		return nil, err
+	}
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		return nil, fmt.Errorf("missing \"image\" form field")
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
 // ImageInfoHandler obtiene información de una imagen
 func ImageInfoHandler(optimizer *images.ImageOptimizer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -57,7 +137,24 @@ func CacheStatsHandler(optimizer *images.ImageOptimizer) http.HandlerFunc {
 		stats := optimizer.GetCacheStats()
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"cache_size":"%v","cache_dir":"%v"}`,
-			stats["cache_size"], stats["cache_dir"])
+		json.NewEncoder(w).Encode(stats)
+	}
+}
+
+// errorStatus traduce los errores del optimizador a códigos HTTP
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, images.ErrInvalidParams):
+		return http.StatusBadRequest
+	case errors.Is(err, images.ErrOriginNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, images.ErrOriginRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, images.ErrSourceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, images.ErrSourceForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
 	}
 }
@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/loxzer01/serve-img-optimized/cache"
+	"github.com/loxzer01/serve-img-optimized/images"
+)
+
+// newTestOptimizer crea un optimizador sobre un caché en disco temporal, sin fuentes de originales
+func newTestOptimizer(t *testing.T) *images.ImageOptimizer {
+	t.Helper()
+	cacheManager := cache.NewCacheManager(t.TempDir(), time.Hour, 10)
+	return images.NewImageOptimizer(cacheManager, &images.Config{}, nil)
+}
+
+// testPNG retorna una imagen PNG válida del ancho y alto indicados
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestUploadImageHandler verifica la optimización de imágenes subidas y la validación de la subida
+func TestUploadImageHandler(t *testing.T) {
+	handler := UploadImageHandler(newTestOptimizer(t), 64*1024)
+	data := testPNG(t, 40, 20)
+
+	multipartBody := func(field string, content []byte, transform string) (*bytes.Buffer, string) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		if transform != "" {
+			writer.WriteField("transform", transform)
+		}
+		part, _ := writer.CreateFormFile(field, "image.png")
+		part.Write(content)
+		writer.Close()
+		return &body, writer.FormDataContentType()
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		body        []byte
+		contentType string
+		status      int
+		resultType  string
+	}{
+		{"raw bytes", "?transform=w_10", data, "image/png", http.StatusOK, "image/jpeg"},
+		{"empty body", "", nil, "image/png", http.StatusBadRequest, ""},
+		{"not an image", "", []byte("hello world, this is not an image"), "text/plain", http.StatusBadRequest, ""},
+		{"invalid transformations", "?transform=w_0", data, "image/png", http.StatusBadRequest, ""},
+		{"too large", "", bytes.Repeat([]byte{0}, 65*1024), "image/png", http.StatusRequestEntityTooLarge, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/image"+test.query, bytes.NewReader(test.body))
+			r.Header.Set("Content-Type", test.contentType)
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.status, w.Body.String())
+			}
+			if test.resultType != "" && w.Header().Get("Content-Type") != test.resultType {
+				t.Errorf("Content-Type = %s, want %s", w.Header().Get("Content-Type"), test.resultType)
+			}
+		})
+	}
+
+	// multipart/form-data con las transformaciones en el formulario
+	body, contentType := multipartBody("image", data, "w_10,q_80")
+	r := httptest.NewRequest("POST", "/api/image", body)
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("multipart status = %d: %s", w.Code, w.Body.String())
+	}
+	result, _, err := image.DecodeConfig(w.Body)
+	if err != nil || result.Width != 10 || result.Height != 5 {
+		t.Errorf("multipart result = %+v, %v; want 10x5", result, err)
+	}
+
+	// Sin el campo "image"
+	body, contentType = multipartBody("file", data, "")
+	r = httptest.NewRequest("POST", "/api/image", body)
+	r.Header.Set("Content-Type", contentType)
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("missing field status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/loxzer01/serve-img-optimized/images"
+)
+
+// SrcsetHandler retorna los srcset y el marcado <picture> de una imagen
+// Formato: /api/srcset?url=@products/a.jpg&widths=320,640,1024&formats=png,jpeg&sizes=50vw
+func SrcsetHandler(optimizer *images.ImageOptimizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("url") == "" {
+			respondWithError(w, http.StatusBadRequest, "URL parameter is required")
+			return
+		}
+
+		req := &images.SrcsetRequest{
+			URL:         query.Get("url"),
+			Origin:      query.Get("origin"),
+			Breakpoints: query.Get("breakpoints"),
+			Sizes:       query.Get("sizes"),
+			Alt:         query.Get("alt"),
+		}
+
+		for _, value := range splitList(query.Get("widths")) {
+			width, err := strconv.Atoi(value)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid width: %s", value))
+				return
+			}
+			req.Widths = append(req.Widths, width)
+		}
+		req.Formats = splitList(query.Get("formats"))
+
+		if quality := query.Get("q"); quality != "" {
+			q, err := strconv.Atoi(quality)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid quality: %s", quality))
+				return
+			}
+			req.Quality = q
+		}
+
+		result, err := optimizer.BuildSrcset(req)
+		if err != nil {
+			respondWithError(w, errorStatus(err), fmt.Sprintf("Error building srcset: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// splitList separa una lista separada por comas ignorando elementos vacíos
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}